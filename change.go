@@ -0,0 +1,123 @@
+package liquo
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Change is one of the Liquibase refactorings that can live inside a
+// changeset (sql, createTable ...). Changes render themselves into the
+// PostgreSQL statements that ChangeSet.Execute runs.
+type Change interface {
+	Statements() ([]Statement, error)
+}
+
+// Statement is a single SQL statement and the arguments that
+// should be passed along with it.
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+// changeTypes maps the Liquibase element names to the Change
+// each one unmarshals into.
+var changeTypes = map[string]func() Change{
+	"sql":         func() Change { return &RawSQL{} },
+	"createTable": func() Change { return &CreateTable{} },
+	"dropTable":   func() Change { return &DropTable{} },
+
+	"addColumn":      func() Change { return &AddColumn{} },
+	"dropColumn":     func() Change { return &DropColumn{} },
+	"renameColumn":   func() Change { return &RenameColumn{} },
+	"modifyDataType": func() Change { return &ModifyDataType{} },
+
+	"createIndex":              func() Change { return &CreateIndex{} },
+	"dropIndex":                func() Change { return &DropIndex{} },
+	"addPrimaryKey":            func() Change { return &AddPrimaryKey{} },
+	"dropPrimaryKey":           func() Change { return &DropPrimaryKey{} },
+	"addUniqueConstraint":      func() Change { return &AddUniqueConstraint{} },
+	"dropUniqueConstraint":     func() Change { return &DropUniqueConstraint{} },
+	"addForeignKeyConstraint":  func() Change { return &AddForeignKeyConstraint{} },
+	"dropForeignKeyConstraint": func() Change { return &DropForeignKeyConstraint{} },
+	"addNotNullConstraint":     func() Change { return &AddNotNullConstraint{} },
+	"dropNotNullConstraint":    func() Change { return &DropNotNullConstraint{} },
+	"addDefaultValue":          func() Change { return &AddDefaultValue{} },
+	"dropDefaultValue":         func() Change { return &DropDefaultValue{} },
+
+	"insert": func() Change { return &Insert{} },
+	"update": func() Change { return &Update{} },
+	"delete": func() Change { return &Delete{} },
+
+	"loadData":       func() Change { return &LoadData{} },
+	"loadUpdateData": func() Change { return &LoadUpdateData{} },
+
+	"tagDatabase": func() Change { return &TagDatabase{} },
+}
+
+// Reversible changes know which changes undo them, these are
+// used to roll back changesets that have no <rollback>.
+type Reversible interface {
+	Reverse() ([]Change, error)
+}
+
+// executor is implemented by the changes that need the connection
+// to run instead of their statements, like loadData using COPY.
+type executor interface {
+	execute(ctx context.Context, conn *pgx.Conn) error
+}
+
+// fileChange is implemented by the changes that read files
+// relative to the migration they were read from.
+type fileChange interface {
+	resolve(migration string)
+}
+
+// changeName returns the Liquibase element name of the change.
+func changeName(c Change) string {
+	t := reflect.TypeOf(c)
+	for name, fn := range changeTypes {
+		if reflect.TypeOf(fn()) == t {
+			return name
+		}
+	}
+
+	return t.String()
+}
+
+// metaElements are changeset children that are not changes
+// and therefore don't produce any SQL.
+var metaElements = map[string]bool{
+	"comment":       true,
+	"rollback":      true,
+	"preConditions": true,
+	"validCheckSum": true,
+	"modifySql":     true,
+}
+
+// RawSQL is the Liquibase <sql> change, its content
+// is executed as it is.
+type RawSQL struct {
+	SQL string `xml:",chardata"`
+}
+
+func (r RawSQL) Statements() ([]Statement, error) {
+	return []Statement{{SQL: r.SQL}}, nil
+}
+
+// qualify prefixes the name with the schema when the
+// schema is set.
+func qualify(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+
+	return schema + "." + name
+}
+
+// quote returns the value as a SQL string literal.
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,131 @@
+package liquo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddColumn is the Liquibase <addColumn> change, it adds one
+// or more columns to an existing table.
+type AddColumn struct {
+	SchemaName string   `xml:"schemaName,attr"`
+	TableName  string   `xml:"tableName,attr"`
+	Columns    []Column `xml:"column"`
+}
+
+func (ac AddColumn) Statements() ([]Statement, error) {
+	if len(ac.Columns) == 0 {
+		return nil, fmt.Errorf("addColumn %v: at least one column is required", ac.TableName)
+	}
+
+	table := qualify(ac.SchemaName, ac.TableName)
+
+	var clauses []string
+	for _, c := range ac.Columns {
+		clauses = append(clauses, "ADD COLUMN "+c.definition())
+		if c.Constraints != nil && c.Constraints.PrimaryKey {
+			clauses = append(clauses, "ADD PRIMARY KEY ("+c.Name+")")
+		}
+
+		if fk := c.foreignKey(); fk != "" {
+			clauses = append(clauses, "ADD "+fk)
+		}
+	}
+
+	stmts := []Statement{{SQL: "ALTER TABLE " + table + " " + strings.Join(clauses, ", ")}}
+	for _, c := range ac.Columns {
+		if c.Remarks == "" {
+			continue
+		}
+
+		stmts = append(stmts, Statement{SQL: "COMMENT ON COLUMN " + table + "." + c.Name + " IS " + quote(c.Remarks)})
+	}
+
+	return stmts, nil
+}
+
+func (ac AddColumn) Reverse() ([]Change, error) {
+	return []Change{DropColumn{SchemaName: ac.SchemaName, TableName: ac.TableName, Columns: ac.Columns}}, nil
+}
+
+// DropColumn is the Liquibase <dropColumn> change, the column to
+// drop can be set in the columnName attribute or as nested columns.
+type DropColumn struct {
+	SchemaName string   `xml:"schemaName,attr"`
+	TableName  string   `xml:"tableName,attr"`
+	ColumnName string   `xml:"columnName,attr"`
+	Columns    []Column `xml:"column"`
+}
+
+func (dc DropColumn) Statements() ([]Statement, error) {
+	var clauses []string
+	if dc.ColumnName != "" {
+		clauses = append(clauses, "DROP COLUMN "+dc.ColumnName)
+	}
+
+	for _, c := range dc.Columns {
+		clauses = append(clauses, "DROP COLUMN "+c.Name)
+	}
+
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("dropColumn %v: columnName is required", dc.TableName)
+	}
+
+	sql := "ALTER TABLE " + qualify(dc.SchemaName, dc.TableName) + " " + strings.Join(clauses, ", ")
+
+	return []Statement{{SQL: sql}}, nil
+}
+
+// RenameColumn is the Liquibase <renameColumn> change.
+type RenameColumn struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	OldColumnName  string `xml:"oldColumnName,attr"`
+	NewColumnName  string `xml:"newColumnName,attr"`
+	ColumnDataType string `xml:"columnDataType,attr"`
+	Remarks        string `xml:"remarks,attr"`
+}
+
+func (rc RenameColumn) Statements() ([]Statement, error) {
+	if rc.OldColumnName == "" || rc.NewColumnName == "" {
+		return nil, fmt.Errorf("renameColumn %v: oldColumnName and newColumnName are required", rc.TableName)
+	}
+
+	table := qualify(rc.SchemaName, rc.TableName)
+	stmts := []Statement{{SQL: "ALTER TABLE " + table + " RENAME COLUMN " + rc.OldColumnName + " TO " + rc.NewColumnName}}
+	if rc.Remarks != "" {
+		stmts = append(stmts, Statement{SQL: "COMMENT ON COLUMN " + table + "." + rc.NewColumnName + " IS " + quote(rc.Remarks)})
+	}
+
+	return stmts, nil
+}
+
+func (rc RenameColumn) Reverse() ([]Change, error) {
+	return []Change{RenameColumn{
+		SchemaName:     rc.SchemaName,
+		TableName:      rc.TableName,
+		OldColumnName:  rc.NewColumnName,
+		NewColumnName:  rc.OldColumnName,
+		ColumnDataType: rc.ColumnDataType,
+	}}, nil
+}
+
+// ModifyDataType is the Liquibase <modifyDataType> change, the existing
+// values are cast into the new type.
+type ModifyDataType struct {
+	SchemaName  string `xml:"schemaName,attr"`
+	TableName   string `xml:"tableName,attr"`
+	ColumnName  string `xml:"columnName,attr"`
+	NewDataType string `xml:"newDataType,attr"`
+}
+
+func (md ModifyDataType) Statements() ([]Statement, error) {
+	if md.ColumnName == "" || md.NewDataType == "" {
+		return nil, fmt.Errorf("modifyDataType %v: columnName and newDataType are required", md.TableName)
+	}
+
+	t := pgType(md.NewDataType)
+	sql := fmt.Sprintf("ALTER TABLE %v ALTER COLUMN %v TYPE %v USING (%v::%v)", qualify(md.SchemaName, md.TableName), md.ColumnName, t, md.ColumnName, t)
+
+	return []Statement{{SQL: sql}}, nil
+}
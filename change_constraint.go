@@ -0,0 +1,323 @@
+package liquo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AddPrimaryKey is the Liquibase <addPrimaryKey> change.
+type AddPrimaryKey struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	ColumnNames    string `xml:"columnNames,attr"`
+	ConstraintName string `xml:"constraintName,attr"`
+	Tablespace     string `xml:"tablespace,attr"`
+	Clustered      bool   `xml:"clustered,attr"`
+}
+
+func (ap AddPrimaryKey) Statements() ([]Statement, error) {
+	if ap.ColumnNames == "" {
+		return nil, fmt.Errorf("addPrimaryKey %v: columnNames is required", ap.TableName)
+	}
+
+	table := qualify(ap.SchemaName, ap.TableName)
+	sql := "ALTER TABLE " + table + " ADD " + constraint(ap.ConstraintName) + "PRIMARY KEY (" + columnList(ap.ColumnNames) + ")"
+	if ap.Tablespace != "" {
+		sql += " USING INDEX TABLESPACE " + ap.Tablespace
+	}
+
+	stmts := []Statement{{SQL: sql}}
+	if ap.Clustered {
+		stmts = append(stmts, Statement{SQL: "CLUSTER " + table + " USING " + ap.constraintName()})
+	}
+
+	return stmts, nil
+}
+
+// constraintName of the primary key, PostgreSQL names
+// primary keys [table]_pkey when no name is given.
+func (ap AddPrimaryKey) constraintName() string {
+	if ap.ConstraintName != "" {
+		return ap.ConstraintName
+	}
+
+	return ap.TableName + "_pkey"
+}
+
+func (ap AddPrimaryKey) Reverse() ([]Change, error) {
+	return []Change{DropPrimaryKey{SchemaName: ap.SchemaName, TableName: ap.TableName, ConstraintName: ap.ConstraintName}}, nil
+}
+
+// DropPrimaryKey is the Liquibase <dropPrimaryKey> change.
+type DropPrimaryKey struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	ConstraintName string `xml:"constraintName,attr"`
+}
+
+func (dp DropPrimaryKey) Statements() ([]Statement, error) {
+	name := dp.ConstraintName
+	if name == "" {
+		name = dp.TableName + "_pkey"
+	}
+
+	return []Statement{{SQL: "ALTER TABLE " + qualify(dp.SchemaName, dp.TableName) + " DROP CONSTRAINT " + name}}, nil
+}
+
+// AddUniqueConstraint is the Liquibase <addUniqueConstraint> change.
+type AddUniqueConstraint struct {
+	SchemaName        string `xml:"schemaName,attr"`
+	TableName         string `xml:"tableName,attr"`
+	ColumnNames       string `xml:"columnNames,attr"`
+	ConstraintName    string `xml:"constraintName,attr"`
+	Tablespace        string `xml:"tablespace,attr"`
+	Deferrable        bool   `xml:"deferrable,attr"`
+	InitiallyDeferred bool   `xml:"initiallyDeferred,attr"`
+}
+
+func (au AddUniqueConstraint) Statements() ([]Statement, error) {
+	if au.ColumnNames == "" {
+		return nil, fmt.Errorf("addUniqueConstraint %v: columnNames is required", au.TableName)
+	}
+
+	sql := "ALTER TABLE " + qualify(au.SchemaName, au.TableName) + " ADD " + constraint(au.ConstraintName) + "UNIQUE (" + columnList(au.ColumnNames) + ")"
+	if au.Tablespace != "" {
+		sql += " USING INDEX TABLESPACE " + au.Tablespace
+	}
+
+	sql += deferrable(au.Deferrable, au.InitiallyDeferred)
+
+	return []Statement{{SQL: sql}}, nil
+}
+
+func (au AddUniqueConstraint) Reverse() ([]Change, error) {
+	if au.ConstraintName == "" {
+		return nil, errors.New("addUniqueConstraint needs a constraintName to be rolled back")
+	}
+
+	return []Change{DropUniqueConstraint{SchemaName: au.SchemaName, TableName: au.TableName, ConstraintName: au.ConstraintName}}, nil
+}
+
+// DropUniqueConstraint is the Liquibase <dropUniqueConstraint> change.
+type DropUniqueConstraint struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	ConstraintName string `xml:"constraintName,attr"`
+}
+
+func (du DropUniqueConstraint) Statements() ([]Statement, error) {
+	if du.ConstraintName == "" {
+		return nil, fmt.Errorf("dropUniqueConstraint %v: constraintName is required", du.TableName)
+	}
+
+	return []Statement{{SQL: "ALTER TABLE " + qualify(du.SchemaName, du.TableName) + " DROP CONSTRAINT " + du.ConstraintName}}, nil
+}
+
+// AddForeignKeyConstraint is the Liquibase <addForeignKeyConstraint> change.
+type AddForeignKeyConstraint struct {
+	BaseTableSchemaName       string `xml:"baseTableSchemaName,attr"`
+	BaseTableName             string `xml:"baseTableName,attr"`
+	BaseColumnNames           string `xml:"baseColumnNames,attr"`
+	ReferencedTableSchemaName string `xml:"referencedTableSchemaName,attr"`
+	ReferencedTableName       string `xml:"referencedTableName,attr"`
+	ReferencedColumnNames     string `xml:"referencedColumnNames,attr"`
+	ConstraintName            string `xml:"constraintName,attr"`
+	OnDelete                  string `xml:"onDelete,attr"`
+	OnUpdate                  string `xml:"onUpdate,attr"`
+	DeleteCascade             bool   `xml:"deleteCascade,attr"`
+	Deferrable                bool   `xml:"deferrable,attr"`
+	InitiallyDeferred         bool   `xml:"initiallyDeferred,attr"`
+}
+
+func (af AddForeignKeyConstraint) Statements() ([]Statement, error) {
+	if af.BaseColumnNames == "" || af.ReferencedTableName == "" || af.ReferencedColumnNames == "" {
+		return nil, fmt.Errorf("addForeignKeyConstraint %v: baseColumnNames, referencedTableName and referencedColumnNames are required", af.BaseTableName)
+	}
+
+	sql := fmt.Sprintf(
+		"ALTER TABLE %v ADD %vFOREIGN KEY (%v) REFERENCES %v (%v)",
+		qualify(af.BaseTableSchemaName, af.BaseTableName),
+		constraint(af.ConstraintName),
+		columnList(af.BaseColumnNames),
+		qualify(af.ReferencedTableSchemaName, af.ReferencedTableName),
+		columnList(af.ReferencedColumnNames),
+	)
+
+	onDelete := af.OnDelete
+	if onDelete == "" && af.DeleteCascade {
+		onDelete = "CASCADE"
+	}
+
+	if onDelete != "" {
+		sql += " ON DELETE " + onDelete
+	}
+
+	if af.OnUpdate != "" {
+		sql += " ON UPDATE " + af.OnUpdate
+	}
+
+	sql += deferrable(af.Deferrable, af.InitiallyDeferred)
+
+	return []Statement{{SQL: sql}}, nil
+}
+
+func (af AddForeignKeyConstraint) Reverse() ([]Change, error) {
+	if af.ConstraintName == "" {
+		return nil, errors.New("addForeignKeyConstraint needs a constraintName to be rolled back")
+	}
+
+	return []Change{DropForeignKeyConstraint{
+		BaseTableSchemaName: af.BaseTableSchemaName,
+		BaseTableName:       af.BaseTableName,
+		ConstraintName:      af.ConstraintName,
+	}}, nil
+}
+
+// DropForeignKeyConstraint is the Liquibase <dropForeignKeyConstraint> change.
+type DropForeignKeyConstraint struct {
+	BaseTableSchemaName string `xml:"baseTableSchemaName,attr"`
+	BaseTableName       string `xml:"baseTableName,attr"`
+	ConstraintName      string `xml:"constraintName,attr"`
+}
+
+func (df DropForeignKeyConstraint) Statements() ([]Statement, error) {
+	if df.ConstraintName == "" {
+		return nil, fmt.Errorf("dropForeignKeyConstraint %v: constraintName is required", df.BaseTableName)
+	}
+
+	return []Statement{{SQL: "ALTER TABLE " + qualify(df.BaseTableSchemaName, df.BaseTableName) + " DROP CONSTRAINT " + df.ConstraintName}}, nil
+}
+
+// AddNotNullConstraint is the Liquibase <addNotNullConstraint> change, when
+// defaultNullValue is set the existing NULL values are updated with it first,
+// it's sent to the database as a parameter like the values of data changes.
+type AddNotNullConstraint struct {
+	SchemaName       string  `xml:"schemaName,attr"`
+	TableName        string  `xml:"tableName,attr"`
+	ColumnName       string  `xml:"columnName,attr"`
+	ColumnDataType   string  `xml:"columnDataType,attr"`
+	DefaultNullValue *string `xml:"defaultNullValue,attr"`
+	ConstraintName   string  `xml:"constraintName,attr"`
+}
+
+func (an AddNotNullConstraint) Statements() ([]Statement, error) {
+	if an.ColumnName == "" {
+		return nil, fmt.Errorf("addNotNullConstraint %v: columnName is required", an.TableName)
+	}
+
+	table := qualify(an.SchemaName, an.TableName)
+
+	var stmts []Statement
+	if an.DefaultNullValue != nil {
+		stmts = append(stmts, Statement{
+			SQL:  "UPDATE " + table + " SET " + an.ColumnName + " = $1 WHERE " + an.ColumnName + " IS NULL",
+			Args: []any{*an.DefaultNullValue},
+		})
+	}
+
+	stmts = append(stmts, Statement{SQL: "ALTER TABLE " + table + " ALTER COLUMN " + an.ColumnName + " SET NOT NULL"})
+
+	return stmts, nil
+}
+
+func (an AddNotNullConstraint) Reverse() ([]Change, error) {
+	return []Change{DropNotNullConstraint{
+		SchemaName:     an.SchemaName,
+		TableName:      an.TableName,
+		ColumnName:     an.ColumnName,
+		ColumnDataType: an.ColumnDataType,
+	}}, nil
+}
+
+// DropNotNullConstraint is the Liquibase <dropNotNullConstraint> change.
+type DropNotNullConstraint struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	ColumnName     string `xml:"columnName,attr"`
+	ColumnDataType string `xml:"columnDataType,attr"`
+}
+
+func (dn DropNotNullConstraint) Statements() ([]Statement, error) {
+	if dn.ColumnName == "" {
+		return nil, fmt.Errorf("dropNotNullConstraint %v: columnName is required", dn.TableName)
+	}
+
+	return []Statement{{SQL: "ALTER TABLE " + qualify(dn.SchemaName, dn.TableName) + " ALTER COLUMN " + dn.ColumnName + " DROP NOT NULL"}}, nil
+}
+
+func (dn DropNotNullConstraint) Reverse() ([]Change, error) {
+	return []Change{AddNotNullConstraint{
+		SchemaName:     dn.SchemaName,
+		TableName:      dn.TableName,
+		ColumnName:     dn.ColumnName,
+		ColumnDataType: dn.ColumnDataType,
+	}}, nil
+}
+
+// AddDefaultValue is the Liquibase <addDefaultValue> change.
+type AddDefaultValue struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	ColumnName     string `xml:"columnName,attr"`
+	ColumnDataType string `xml:"columnDataType,attr"`
+
+	DefaultValues
+}
+
+func (ad AddDefaultValue) Statements() ([]Statement, error) {
+	value, ok := ad.defaultValue()
+	if ad.ColumnName == "" || !ok {
+		return nil, fmt.Errorf("addDefaultValue %v: columnName and a default value are required", ad.TableName)
+	}
+
+	return []Statement{{SQL: "ALTER TABLE " + qualify(ad.SchemaName, ad.TableName) + " ALTER COLUMN " + ad.ColumnName + " SET DEFAULT " + value}}, nil
+}
+
+func (ad AddDefaultValue) Reverse() ([]Change, error) {
+	return []Change{DropDefaultValue{
+		SchemaName:     ad.SchemaName,
+		TableName:      ad.TableName,
+		ColumnName:     ad.ColumnName,
+		ColumnDataType: ad.ColumnDataType,
+	}}, nil
+}
+
+// DropDefaultValue is the Liquibase <dropDefaultValue> change.
+type DropDefaultValue struct {
+	SchemaName     string `xml:"schemaName,attr"`
+	TableName      string `xml:"tableName,attr"`
+	ColumnName     string `xml:"columnName,attr"`
+	ColumnDataType string `xml:"columnDataType,attr"`
+}
+
+func (dd DropDefaultValue) Statements() ([]Statement, error) {
+	if dd.ColumnName == "" {
+		return nil, fmt.Errorf("dropDefaultValue %v: columnName is required", dd.TableName)
+	}
+
+	return []Statement{{SQL: "ALTER TABLE " + qualify(dd.SchemaName, dd.TableName) + " ALTER COLUMN " + dd.ColumnName + " DROP DEFAULT"}}, nil
+}
+
+// constraint returns the CONSTRAINT [name] prefix when
+// the constraint has a name.
+func constraint(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	return "CONSTRAINT " + name + " "
+}
+
+// deferrable returns the deferrable clauses for
+// unique and foreign key constraints.
+func deferrable(deferrable, initiallyDeferred bool) string {
+	if !deferrable {
+		return ""
+	}
+
+	if initiallyDeferred {
+		return " DEFERRABLE INITIALLY DEFERRED"
+	}
+
+	return " DEFERRABLE"
+}
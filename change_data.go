@@ -0,0 +1,89 @@
+package liquo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Insert is the Liquibase <insert> change, the column values
+// are sent to the database as parameters.
+type Insert struct {
+	SchemaName string   `xml:"schemaName,attr"`
+	TableName  string   `xml:"tableName,attr"`
+	Columns    []Column `xml:"column"`
+}
+
+func (in Insert) Statements() ([]Statement, error) {
+	if len(in.Columns) == 0 {
+		return nil, fmt.Errorf("insert %v: at least one column is required", in.TableName)
+	}
+
+	var names, values []string
+	var args []any
+	for _, c := range in.Columns {
+		var value string
+		value, args = c.value(args)
+
+		names = append(names, c.Name)
+		values = append(values, value)
+	}
+
+	sql := "INSERT INTO " + qualify(in.SchemaName, in.TableName) + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+
+	return []Statement{{SQL: sql, Args: args}}, nil
+}
+
+// Update is the Liquibase <update> change, the where
+// condition is used as it is.
+type Update struct {
+	SchemaName string   `xml:"schemaName,attr"`
+	TableName  string   `xml:"tableName,attr"`
+	Columns    []Column `xml:"column"`
+	Where      string   `xml:"where"`
+}
+
+func (up Update) Statements() ([]Statement, error) {
+	if len(up.Columns) == 0 {
+		return nil, fmt.Errorf("update %v: at least one column is required", up.TableName)
+	}
+
+	var sets []string
+	var args []any
+	for _, c := range up.Columns {
+		var value string
+		value, args = c.value(args)
+
+		sets = append(sets, c.Name+" = "+value)
+	}
+
+	sql := "UPDATE " + qualify(up.SchemaName, up.TableName) + " SET " + strings.Join(sets, ", ") + where(up.Where)
+
+	return []Statement{{SQL: sql, Args: args}}, nil
+}
+
+// Delete is the Liquibase <delete> change.
+type Delete struct {
+	SchemaName string `xml:"schemaName,attr"`
+	TableName  string `xml:"tableName,attr"`
+	Where      string `xml:"where"`
+}
+
+func (de Delete) Statements() ([]Statement, error) {
+	if de.TableName == "" {
+		return nil, errors.New("delete: tableName is required")
+	}
+
+	return []Statement{{SQL: "DELETE FROM " + qualify(de.SchemaName, de.TableName) + where(de.Where)}}, nil
+}
+
+// where returns the WHERE clause for the condition
+// or nothing when the condition is empty.
+func where(condition string) string {
+	condition = strings.TrimSpace(condition)
+	if condition == "" {
+		return ""
+	}
+
+	return " WHERE " + condition
+}
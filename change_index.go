@@ -0,0 +1,71 @@
+package liquo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CreateIndex is the Liquibase <createIndex> change. Clustered indexes
+// are emulated in PostgreSQL by clustering the table on the index.
+type CreateIndex struct {
+	SchemaName string   `xml:"schemaName,attr"`
+	TableName  string   `xml:"tableName,attr"`
+	IndexName  string   `xml:"indexName,attr"`
+	Unique     bool     `xml:"unique,attr"`
+	Clustered  bool     `xml:"clustered,attr"`
+	Tablespace string   `xml:"tablespace,attr"`
+	Columns    []Column `xml:"column"`
+}
+
+func (ci CreateIndex) Statements() ([]Statement, error) {
+	if ci.IndexName == "" || len(ci.Columns) == 0 {
+		return nil, fmt.Errorf("createIndex %v: indexName and at least one column are required", ci.TableName)
+	}
+
+	var columns []string
+	for _, c := range ci.Columns {
+		if c.Descending {
+			columns = append(columns, c.Name+" DESC")
+			continue
+		}
+
+		columns = append(columns, c.Name)
+	}
+
+	table := qualify(ci.SchemaName, ci.TableName)
+	create := "CREATE INDEX "
+	if ci.Unique {
+		create = "CREATE UNIQUE INDEX "
+	}
+
+	sql := create + ci.IndexName + " ON " + table + " (" + strings.Join(columns, ", ") + ")"
+	if ci.Tablespace != "" {
+		sql += " TABLESPACE " + ci.Tablespace
+	}
+
+	stmts := []Statement{{SQL: sql}}
+	if ci.Clustered {
+		stmts = append(stmts, Statement{SQL: "CLUSTER " + table + " USING " + ci.IndexName})
+	}
+
+	return stmts, nil
+}
+
+func (ci CreateIndex) Reverse() ([]Change, error) {
+	return []Change{DropIndex{SchemaName: ci.SchemaName, TableName: ci.TableName, IndexName: ci.IndexName}}, nil
+}
+
+// DropIndex is the Liquibase <dropIndex> change.
+type DropIndex struct {
+	SchemaName string `xml:"schemaName,attr"`
+	TableName  string `xml:"tableName,attr"`
+	IndexName  string `xml:"indexName,attr"`
+}
+
+func (di DropIndex) Statements() ([]Statement, error) {
+	if di.IndexName == "" {
+		return nil, fmt.Errorf("dropIndex %v: indexName is required", di.TableName)
+	}
+
+	return []Statement{{SQL: "DROP INDEX " + qualify(di.SchemaName, di.IndexName)}}, nil
+}
@@ -0,0 +1,387 @@
+package liquo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// csvFile holds the attributes shared by loadData and loadUpdateData
+// to point at a CSV file and describe its columns.
+type csvFile struct {
+	SchemaName              string   `xml:"schemaName,attr"`
+	TableName               string   `xml:"tableName,attr"`
+	File                    string   `xml:"file,attr"`
+	RelativeToChangelogFile bool     `xml:"relativeToChangelogFile,attr"`
+	Separator               string   `xml:"separator,attr"`
+	QuotChar                string   `xml:"quotchar,attr"`
+	Encoding                string   `xml:"encoding,attr"`
+	CommentLineStartsWith   string   `xml:"commentLineStartsWith,attr"`
+	Columns                 []Column `xml:"column"`
+
+	// migration is the path of the migration file the
+	// change was read from.
+	migration string
+}
+
+// resolve sets the migration file the change was read from so
+// the CSV file can be found next to it.
+func (f *csvFile) resolve(migration string) {
+	f.migration = migration
+}
+
+// path of the CSV file. Like Liquibase, files are looked up from the working
+// directory unless relativeToChangelogFile is set, in that case or when the
+// file isn't there, they are looked up next to the migration.
+func (f csvFile) path() string {
+	relative := filepath.Join(filepath.Dir(f.migration), f.File)
+	if f.RelativeToChangelogFile || filepath.IsAbs(f.File) {
+		return relative
+	}
+
+	if _, err := os.Stat(f.File); err != nil {
+		return relative
+	}
+
+	return f.File
+}
+
+// contents of the CSV file, these are part of the
+// checksum of the change.
+func (f csvFile) contents() ([]byte, error) {
+	return os.ReadFile(f.path())
+}
+
+// load reads the CSV file, it returns the columns the data goes into and the
+// rows with nil for NULL values. SKIP columns are left out.
+func (f csvFile) load() ([]Column, [][]*string, error) {
+	file, err := os.Open(f.path())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	encoding := f.Encoding
+	if encoding == "" {
+		encoding = "UTF-8"
+	}
+
+	enc, err := htmlindex.Get(encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported encoding %v", encoding)
+	}
+
+	separator, quote := ',', '"'
+	if f.Separator != "" {
+		separator, _ = utf8.DecodeRuneInString(f.Separator)
+	}
+
+	if f.QuotChar != "" {
+		quote, _ = utf8.DecodeRuneInString(f.QuotChar)
+	}
+
+	records, err := readCSV(enc.NewDecoder().Reader(file), separator, quote, f.CommentLineStartsWith)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %v: %w", f.File, err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("%v has no header", f.File)
+	}
+
+	var columns []Column
+	var indexes []int
+	for i, header := range records[0] {
+		column := f.column(strings.TrimSpace(header))
+		if strings.EqualFold(column.Type, "SKIP") {
+			continue
+		}
+
+		if _, ok := csvTypes[strings.ToUpper(column.Type)]; !ok {
+			return nil, nil, fmt.Errorf("column %v: unsupported type %v", column.Name, column.Type)
+		}
+
+		columns = append(columns, column)
+		indexes = append(indexes, i)
+	}
+
+	var rows [][]*string
+	for n, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			return nil, nil, fmt.Errorf("%v line %v has %v values, expected %v", f.File, n+2, len(record), len(records[0]))
+		}
+
+		row := make([]*string, len(indexes))
+		for i, index := range indexes {
+			value := record[index]
+			if value == "" || strings.EqualFold(value, "NULL") {
+				continue
+			}
+
+			value, err := csvTypes[strings.ToUpper(columns[i].Type)](value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%v line %v column %v: %w", f.File, n+2, columns[i].Name, err)
+			}
+
+			row[i] = &value
+		}
+
+		rows = append(rows, row)
+	}
+
+	return columns, rows, nil
+}
+
+// csvTypes are the column types of CSV files, each one checks the values
+// of its columns and returns them the way PostgreSQL parses them. Values
+// are sent as text so these go into the column type like in SQL.
+var csvTypes = map[string]func(string) (string, error){
+	"":         csvString,
+	"STRING":   csvString,
+	"UNKNOWN":  csvString,
+	"COMPUTED": csvString,
+	"UUID":     csvString,
+	"BOOLEAN": func(value string) (string, error) {
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("invalid BOOLEAN %q", value)
+		}
+
+		return strconv.FormatBool(b), nil
+	},
+	"NUMERIC": func(value string) (string, error) {
+		value = strings.TrimSpace(value)
+		if _, ok := new(big.Float).SetString(value); !ok {
+			return "", fmt.Errorf("invalid NUMERIC %q", value)
+		}
+
+		return value, nil
+	},
+	"DATE":     csvTime(time.DateOnly),
+	"DATETIME": csvTime(time.DateTime, "2006-01-02T15:04:05", time.RFC3339Nano),
+}
+
+func csvString(value string) (string, error) {
+	return value, nil
+}
+
+// csvTime returns a column type for times in any of the layouts,
+// fractional seconds are accepted after the seconds.
+func csvTime(layouts ...string) func(string) (string, error) {
+	return func(value string) (string, error) {
+		value = strings.TrimSpace(value)
+		for _, layout := range layouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return value, nil
+			}
+		}
+
+		return "", fmt.Errorf("invalid date %q, use %v", value, layouts[0])
+	}
+}
+
+// column for a CSV header, the header is matched against the header
+// attribute of the columns or their name when they have no header.
+func (f csvFile) column(header string) Column {
+	for _, c := range f.Columns {
+		if c.Header == header || (c.Header == "" && c.Name == header) {
+			return c
+		}
+	}
+
+	return Column{Name: header}
+}
+
+// rowValues returns the SQL values for a row and the args they reference.
+// COMPUTED values are used as SQL, the rest are passed as args.
+func rowValues(columns []Column, row []*string) ([]string, []any) {
+	var values []string
+	var args []any
+	for i, value := range row {
+		switch {
+		case value == nil:
+			values = append(values, "NULL")
+		case strings.EqualFold(columns[i].Type, "COMPUTED"):
+			values = append(values, *value)
+		default:
+			args = append(args, *value)
+			values = append(values, fmt.Sprintf("$%d", len(args)))
+		}
+	}
+
+	return values, args
+}
+
+func hasComputed(columns []Column) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c.Type, "COMPUTED") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func columnNames(columns []Column) []string {
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// LoadData is the Liquibase <loadData> change, it loads the rows
+// of a CSV file into a table.
+type LoadData struct {
+	csvFile
+}
+
+// Statements renders one INSERT per row of the file, these are used when
+// the data can't be copied, Execute uses COPY otherwise.
+func (ld LoadData) Statements() ([]Statement, error) {
+	columns, rows, err := ld.load()
+	if err != nil {
+		return nil, fmt.Errorf("loadData %v: %w", ld.TableName, err)
+	}
+
+	table := qualify(ld.SchemaName, ld.TableName)
+	names := strings.Join(columnNames(columns), ", ")
+
+	var stmts []Statement
+	for _, row := range rows {
+		values, args := rowValues(columns, row)
+		stmts = append(stmts, Statement{
+			SQL:  "INSERT INTO " + table + " (" + names + ") VALUES (" + strings.Join(values, ", ") + ")",
+			Args: args,
+		})
+	}
+
+	return stmts, nil
+}
+
+// execute copies the rows into the table. COPY is done in CSV format at the
+// connection level so PostgreSQL takes care of parsing the values into the
+// column types. Files with COMPUTED columns are inserted row by row.
+func (ld LoadData) execute(ctx context.Context, conn *pgx.Conn) error {
+	columns, rows, err := ld.load()
+	if err != nil {
+		return fmt.Errorf("loadData %v: %w", ld.TableName, err)
+	}
+
+	if hasComputed(columns) {
+		stmts, err := ld.Statements()
+		if err != nil {
+			return err
+		}
+
+		return execStatements(ctx, conn, stmts)
+	}
+
+	var data strings.Builder
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				data.WriteString(",")
+			}
+
+			// Unquoted empty values are NULL in CSV COPY.
+			if value != nil {
+				data.WriteString(`"` + strings.ReplaceAll(*value, `"`, `""`) + `"`)
+			}
+		}
+
+		data.WriteString("\n")
+	}
+
+	sql := "COPY " + qualify(ld.SchemaName, ld.TableName) + " (" + strings.Join(columnNames(columns), ", ") + ") FROM STDIN WITH (FORMAT csv)"
+	_, err = conn.PgConn().CopyFrom(ctx, strings.NewReader(data.String()), sql)
+
+	return err
+}
+
+// LoadUpdateData is the Liquibase <loadUpdateData> change, rows in the CSV
+// file are inserted or updated when a row with the same primary key exists.
+type LoadUpdateData struct {
+	csvFile
+
+	PrimaryKey string `xml:"primaryKey,attr"`
+	OnlyUpdate bool   `xml:"onlyUpdate,attr"`
+}
+
+func (lu LoadUpdateData) Statements() ([]Statement, error) {
+	if lu.PrimaryKey == "" {
+		return nil, errors.New("loadUpdateData: primaryKey is required")
+	}
+
+	columns, rows, err := lu.load()
+	if err != nil {
+		return nil, fmt.Errorf("loadUpdateData %v: %w", lu.TableName, err)
+	}
+
+	keys := map[string]bool{}
+	for _, k := range strings.Split(lu.PrimaryKey, ",") {
+		keys[strings.TrimSpace(k)] = true
+	}
+
+	table := qualify(lu.SchemaName, lu.TableName)
+	names := columnNames(columns)
+
+	var updates []string
+	for _, name := range names {
+		if keys[name] {
+			continue
+		}
+
+		updates = append(updates, name+" = EXCLUDED."+name)
+	}
+
+	var stmts []Statement
+	for _, row := range rows {
+		values, args := rowValues(columns, row)
+		if lu.OnlyUpdate {
+			stmts = append(stmts, lu.update(table, names, values, keys, args))
+			continue
+		}
+
+		sql := "INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+		sql += " ON CONFLICT (" + columnList(lu.PrimaryKey) + ")"
+		if len(updates) == 0 {
+			sql += " DO NOTHING"
+		} else {
+			sql += " DO UPDATE SET " + strings.Join(updates, ", ")
+		}
+
+		stmts = append(stmts, Statement{SQL: sql, Args: args})
+	}
+
+	return stmts, nil
+}
+
+// update renders the UPDATE statement used for a row when onlyUpdate is set.
+func (lu LoadUpdateData) update(table string, names, values []string, keys map[string]bool, args []any) Statement {
+	var sets, conditions []string
+	for i, name := range names {
+		if keys[name] {
+			conditions = append(conditions, name+" = "+values[i])
+			continue
+		}
+
+		sets = append(sets, name+" = "+values[i])
+	}
+
+	return Statement{
+		SQL:  "UPDATE " + table + " SET " + strings.Join(sets, ", ") + " WHERE " + strings.Join(conditions, " AND "),
+		Args: args,
+	}
+}
@@ -0,0 +1,101 @@
+package liquo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CreateTable is the Liquibase <createTable> change.
+type CreateTable struct {
+	SchemaName string   `xml:"schemaName,attr"`
+	TableName  string   `xml:"tableName,attr"`
+	Tablespace string   `xml:"tablespace,attr"`
+	Remarks    string   `xml:"remarks,attr"`
+	Columns    []Column `xml:"column"`
+}
+
+func (ct CreateTable) Statements() ([]Statement, error) {
+	if ct.TableName == "" {
+		return nil, errors.New("createTable: tableName is required")
+	}
+
+	if len(ct.Columns) == 0 {
+		return nil, fmt.Errorf("createTable %v: at least one column is required", ct.TableName)
+	}
+
+	table := qualify(ct.SchemaName, ct.TableName)
+
+	var lines, pk, foreignKeys []string
+	var pkName string
+	for _, c := range ct.Columns {
+		lines = append(lines, c.definition())
+		if fk := c.foreignKey(); fk != "" {
+			foreignKeys = append(foreignKeys, fk)
+		}
+
+		if c.Constraints == nil || !c.Constraints.PrimaryKey {
+			continue
+		}
+
+		pk = append(pk, c.Name)
+		if c.Constraints.PrimaryKeyName != "" {
+			pkName = c.Constraints.PrimaryKeyName
+		}
+	}
+
+	if len(pk) > 0 {
+		clause := "PRIMARY KEY (" + strings.Join(pk, ", ") + ")"
+		if pkName != "" {
+			clause = "CONSTRAINT " + pkName + " " + clause
+		}
+
+		lines = append(lines, clause)
+	}
+
+	lines = append(lines, foreignKeys...)
+
+	sql := "CREATE TABLE " + table + " (\n\t" + strings.Join(lines, ",\n\t") + "\n)"
+	if ct.Tablespace != "" {
+		sql += " TABLESPACE " + ct.Tablespace
+	}
+
+	stmts := []Statement{{SQL: sql}}
+	if ct.Remarks != "" {
+		stmts = append(stmts, Statement{SQL: "COMMENT ON TABLE " + table + " IS " + quote(ct.Remarks)})
+	}
+
+	for _, c := range ct.Columns {
+		if c.Remarks == "" {
+			continue
+		}
+
+		stmts = append(stmts, Statement{SQL: "COMMENT ON COLUMN " + table + "." + c.Name + " IS " + quote(c.Remarks)})
+	}
+
+	return stmts, nil
+}
+
+func (ct CreateTable) Reverse() ([]Change, error) {
+	return []Change{DropTable{SchemaName: ct.SchemaName, TableName: ct.TableName}}, nil
+}
+
+// DropTable is the Liquibase <dropTable> change.
+type DropTable struct {
+	SchemaName         string `xml:"schemaName,attr"`
+	TableName          string `xml:"tableName,attr"`
+	CascadeConstraints bool   `xml:"cascadeConstraints,attr"`
+}
+
+func (dt DropTable) Statements() ([]Statement, error) {
+	if dt.TableName == "" {
+		return nil, errors.New("dropTable: tableName is required")
+	}
+
+	sql := "DROP TABLE " + qualify(dt.SchemaName, dt.TableName)
+	if dt.CascadeConstraints {
+		sql += " CASCADE"
+	}
+
+	return []Statement{{SQL: sql}}, nil
+}
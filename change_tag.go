@@ -0,0 +1,23 @@
+package liquo
+
+import "errors"
+
+// TagDatabase is the Liquibase <tagDatabase> change, the tag is stored
+// in the databasechangelog row of its changeset when this runs.
+type TagDatabase struct {
+	Tag string `xml:"tag,attr"`
+}
+
+func (td TagDatabase) Statements() ([]Statement, error) {
+	if td.Tag == "" {
+		return nil, errors.New("tagDatabase: tag is required")
+	}
+
+	return nil, nil
+}
+
+// Reverse of a tag is a no-op, the tag goes
+// away with the databasechangelog row.
+func (td TagDatabase) Reverse() ([]Change, error) {
+	return nil, nil
+}
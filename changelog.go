@@ -6,12 +6,29 @@ import "encoding/xml"
 // This is the root migrations commander, the tool only considers
 // migration files in the changelog.
 type ChangeLog struct {
-	XMLName    xml.Name        `xml:"databaseChangeLog"`
-	Migrations []MigrationFile `xml:"include"`
+	XMLName       xml.Name        `xml:"databaseChangeLog"`
+	PreConditions *PreConditions  `xml:"preConditions"`
+	Migrations    []MigrationFile `xml:"include"`
 }
 
 // MigrationFiles in the changelog. These are used to
 // get the file path to the migration.
 type MigrationFile struct {
 	File string `xml:"file,attr"`
+
+	// Context and Labels apply to all the changesets
+	// in the file, along with their own.
+	Context       string `xml:"context,attr"`
+	ContextFilter string `xml:"contextFilter,attr"`
+	Labels        string `xml:"labels,attr"`
+}
+
+// contexts returns the context expression of the include,
+// contextFilter is the newer name of the context attribute.
+func (mf MigrationFile) contexts() string {
+	if mf.ContextFilter != "" {
+		return mf.ContextFilter
+	}
+
+	return mf.Context
 }
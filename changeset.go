@@ -1,9 +1,12 @@
 package liquo
 
 import (
+	"bytes"
 	"context"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -13,72 +16,422 @@ import (
 
 // ChangeSet with SQL and Rollback instructions.
 type ChangeSet struct {
-	ID          string   `xml:"id,attr"`
-	Author      string   `xml:"author,attr"`
-	SQL         []string `xml:"sql"`
-	RollbackSQL string   `xml:"rollback"`
+	ID        string     `xml:"id,attr"`
+	Author    string     `xml:"author,attr"`
+	SQL       []string   `xml:"sql"`
+	Rollbacks []Rollback `xml:"rollback"`
+	Comment   string     `xml:"comment"`
+
+	// LogicalFilePath is stored as the filename of the changeset instead
+	// of the path of its file, so moving the file keeps its identity.
+	LogicalFilePath string `xml:"logicalFilePath,attr"`
+
+	// Context is the expression of contexts the changeset runs on and
+	// Labels the list of labels to filter it with, see Command.included.
+	Context       string `xml:"context,attr"`
+	ContextFilter string `xml:"contextFilter,attr"`
+	Labels        string `xml:"labels,attr"`
+
+	// RunOnChange changesets are allowed to change after being executed
+	// and run again when they do, RunAlways ones run on every update.
+	// ValidCheckSums lists other checksums accepted for the changeset.
+	RunOnChange    bool     `xml:"runOnChange,attr"`
+	RunAlways      bool     `xml:"runAlways,attr"`
+	ValidCheckSums []string `xml:"validCheckSum"`
+
+	// FailOnError defaults to true, when false errors running the
+	// changeset are logged and the changeset is recorded as FAILED.
+	FailOnError *bool `xml:"failOnError,attr"`
+
+	// RunInTransaction defaults to true, statements like CREATE INDEX
+	// CONCURRENTLY need it to be false to run outside of one.
+	RunInTransaction *bool `xml:"runInTransaction,attr"`
+
+	PreConditions *PreConditions `xml:"preConditions"`
+
+	// Changes in the changeset in the order they were written,
+	// including the <sql> ones.
+	Changes []Change `xml:"-"`
+}
+
+// ErrNoRollback is returned when rolling back a changeset that has no
+// <rollback> and whose changes can't be reversed automatically.
+var ErrNoRollback = errors.New("no rollback available")
+
+// UnmarshalXML decodes the changeset attributes and then walks
+// its inner xml to decode the changes in it.
+func (cs *ChangeSet) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type changeSet ChangeSet
+	var raw struct {
+		changeSet
+		Inner []byte `xml:",innerxml"`
+	}
+
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*cs = ChangeSet(raw.changeSet)
+
+	changes, err := decodeChanges(raw.Inner)
+	if err != nil {
+		return fmt.Errorf("changeset `%v`: %w", cs.ID, err)
+	}
+
+	cs.Changes = changes
+
+	return nil
+}
+
+// decodeChanges walks the inner xml of a changeset or rollback and
+// decodes the changes in it in the same order they were written.
+func decodeChanges(inner []byte) ([]Change, error) {
+	var changes []Change
+	d := xml.NewDecoder(bytes.NewReader(inner))
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return changes, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		name := se.Name.Local
+		if metaElements[name] {
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		fn, ok := changeTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported change type <%v>", name)
+		}
+
+		change := fn()
+		if err := d.DecodeElement(change, &se); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
 }
 
 // Execute a changeset takes the SQL part of the changeset and runs it.
+// Changesets whose preconditions fail with CONTINUE are skipped and with
+// MARK_RAN are recorded without running. Executed changesets only run
+// again when they are runAlways or runOnChange and they changed. Only the
+// row of the changeset is read, to run many changesets use Command.Up,
+// which reads the databasechangelog table once.
 func (cs ChangeSet) Execute(conn *pgx.Conn, file string) error {
-	var err error
 	ctx := context.Background()
 
-	row := conn.QueryRow(context.Background(), `SELECT orderexecuted FROM databasechangelog ORDER BY dateexecuted desc`)
-	var order int
-	if err = row.Scan(&order); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+	h, err := loadChangeSetHistory(ctx, conn, cs, file)
+	if err != nil {
 		return err
 	}
 
-	var count int
-	row = conn.QueryRow(ctx, `SELECT count(*) FROM databasechangelog WHERE id = $1`, cs.ID)
-	if err = row.Scan(&count); err == nil && count > 0 {
+	return cs.execute(ctx, conn, file, h)
+}
+
+// execute runs the changeset if it's pending in the history
+// and keeps the history up to date with it.
+func (cs ChangeSet) execute(ctx context.Context, conn *pgx.Conn, file string, h *changeLogHistory) error {
+	if !h.pending(cs, file) {
 		return nil
 	}
 
+	action, err := cs.PreConditions.verify(ctx, conn, fmt.Sprintf("changeset `%v`", cs.ID))
 	if err != nil {
-		return fmt.Errorf("Error checking if changeset %v has already been executed:%w", cs.ID, err)
+		return err
+	}
+
+	switch action {
+	case onFailContinue:
+		return nil
+	case onFailMarkRan:
+		return cs.markRan(ctx, conn, file, h)
+	}
+
+	exectype := h.exectype(cs, file)
+	err = cs.transaction(ctx, conn, func(conn *pgx.Conn) error {
+		err := cs.run(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return cs.record(ctx, conn, file, exectype, h)
+	})
+
+	if err != nil && cs.FailOnError != nil && !*cs.FailOnError {
+		log.Errorf("changeset `%v` failed, continuing since failOnError is false: %v\n", cs.ID, err)
+
+		err = cs.record(ctx, conn, file, "FAILED", h)
+		if err != nil {
+			return err
+		}
+
+		h.fail(cs, file, h.order+1)
+
+		return nil
 	}
 
-	_, err = conn.Exec(ctx, cs.sql())
 	if err != nil {
 		return err
 	}
 
-	insertStmt := `
-		INSERT
-		INTO databasechangelog (id, author, filename, dateexecuted, orderexecuted,exectype)
-		VALUES ($1, $2, $3, $4, $5, $6);
-	`
+	h.add(cs, file, h.order+1)
+	log.Infof("Executed `%v`.", cs.ID)
+
+	return nil
+}
+
+// contexts returns the context expression of the changeset,
+// contextFilter is the newer name of the context attribute.
+func (cs ChangeSet) contexts() string {
+	if cs.ContextFilter != "" {
+		return cs.ContextFilter
+	}
+
+	return cs.Context
+}
 
-	_, err = conn.Exec(ctx, insertStmt, cs.ID, cs.Author, file, time.Now(), order+1, "EXECUTED")
+// markRan records the changeset as executed without running
+// it, unless it has been executed already.
+func (cs ChangeSet) markRan(ctx context.Context, conn *pgx.Conn, file string, h *changeLogHistory) error {
+	if executed, _ := h.executed(cs, file); executed {
+		return nil
+	}
+
+	err := cs.record(ctx, conn, file, "MARK_RAN", h)
 	if err != nil {
 		return err
 	}
 
-	log.Infof("Executed `%v`.", cs.ID)
-	order++
+	h.add(cs, file, h.order+1)
 
 	return nil
 }
 
+// record stores the changeset in the databasechangelog table.
+func (cs ChangeSet) record(ctx context.Context, conn *pgx.Conn, file, exectype string, h *changeLogHistory) error {
+	stmt := cs.recordStatement(file, exectype, h)
+	_, err := conn.Exec(ctx, stmt.SQL, stmt.Args...)
+
+	return err
+}
+
+// recordStatement returns the statement that stores the changeset in the
+// databasechangelog table with the passed exectype and the next order of
+// the history, changesets that run again or failed before get their row
+// updated.
+func (cs ChangeSet) recordStatement(file, exectype string, h *changeLogHistory) Statement {
+	stmt := `
+		INSERT
+		INTO databasechangelog (id, author, filename, dateexecuted, orderexecuted, exectype, md5sum, contexts, labels, description, comments, liquibase, deployment_id, tag)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14);
+	`
+
+	if h.recorded(cs, file) {
+		stmt = `
+			UPDATE databasechangelog
+			SET dateexecuted = $4, orderexecuted = $5, exectype = $6, md5sum = $7, contexts = $8, labels = $9,
+				description = $10, comments = $11, liquibase = $12, deployment_id = $13, tag = $14
+			WHERE id = $1 AND author = $2 AND filename = $3;
+		`
+	}
+
+	return Statement{SQL: stmt, Args: []any{
+		cs.ID, cs.Author, file, time.Now(), h.order + 1, exectype, cs.Checksum(),
+		nullable(cs.contexts()), nullable(cs.Labels), nullable(cs.description()),
+		nullable(truncate(strings.TrimSpace(cs.Comment), 255)), writtenBy, h.deploymentID, nullable(cs.tag()),
+	}}
+}
+
 // Rollback the changeset runs the Rollback section of the
-// changeset.
-func (cs ChangeSet) Rollback(conn *pgx.Conn) error {
-	log.Infof("Rolling back %v. \n", cs.ID)
-	_, err := conn.Exec(context.Background(), cs.RollbackSQL)
+// changeset, when the changeset has no Rollback section the
+// rollback is inferred from its changes.
+func (cs ChangeSet) Rollback(conn *pgx.Conn, file string) error {
+	stmts, err := cs.rollbackStatements()
 	if err != nil {
 		return err
 	}
 
-	_, err = conn.Exec(context.Background(), `DELETE FROM databasechangelog WHERE id = $1`, cs.ID)
-	if err != nil {
+	return cs.rollback(context.Background(), conn, file, stmts)
+}
+
+// rollback runs the rollback statements of the changeset and removes
+// its databasechangelog row in the same transaction.
+func (cs ChangeSet) rollback(ctx context.Context, conn *pgx.Conn, file string, stmts []Statement) error {
+	log.Infof("Rolling back %v. \n", cs.ID)
+
+	return cs.transaction(ctx, conn, func(conn *pgx.Conn) error {
+		err := execStatements(ctx, conn, stmts)
+		if err != nil {
+			return err
+		}
+
+		stmt := cs.unrecordStatement(file)
+		_, err = conn.Exec(ctx, stmt.SQL, stmt.Args...)
+
 		return err
+	})
+}
+
+// unrecordStatement returns the statement that removes the
+// changeset from the databasechangelog table.
+func (cs ChangeSet) unrecordStatement(file string) Statement {
+	return Statement{
+		SQL:  `DELETE FROM databasechangelog WHERE id = $1 AND author = $2 AND filename = $3`,
+		Args: []any{cs.ID, cs.Author, file},
+	}
+}
+
+// transaction runs fn in a transaction unless the changeset has
+// runInTransaction="false", then fn runs directly on the connection.
+func (cs ChangeSet) transaction(ctx context.Context, conn *pgx.Conn, fn func(*pgx.Conn) error) error {
+	if cs.RunInTransaction != nil && !*cs.RunInTransaction {
+		return fn(conn)
+	}
+
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		return fn(tx.Conn())
+	})
+}
+
+// run executes the changes of the changeset in order.
+func (cs ChangeSet) run(ctx context.Context, conn *pgx.Conn) error {
+	for _, c := range cs.Changes {
+		if e, ok := c.(executor); ok {
+			if err := e.execute(ctx, conn); err != nil {
+				return fmt.Errorf("changeset `%v`: %w", cs.ID, err)
+			}
+
+			continue
+		}
+
+		stmts, err := c.Statements()
+		if err != nil {
+			return fmt.Errorf("changeset `%v`: %w", cs.ID, err)
+		}
+
+		if err := execStatements(ctx, conn, stmts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execStatements runs the statements one after the other.
+func execStatements(ctx context.Context, conn *pgx.Conn, stmts []Statement) error {
+	for _, stmt := range stmts {
+		_, err := conn.Exec(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// statements renders the changes of the changeset in order.
+func (cs ChangeSet) statements() ([]Statement, error) {
+	var stmts []Statement
+	for _, c := range cs.Changes {
+		s, err := c.Statements()
+		if err != nil {
+			return nil, fmt.Errorf("changeset `%v`: %w", cs.ID, err)
+		}
+
+		stmts = append(stmts, s...)
+	}
+
+	return stmts, nil
+}
+
+// rollbackStatements returns the statements of the <rollback> elements or
+// the ones that reverse the changes when the changeset doesn't have any.
+func (cs ChangeSet) rollbackStatements() ([]Statement, error) {
+	if len(cs.Rollbacks) > 0 {
+		var stmts []Statement
+		for _, rb := range cs.Rollbacks {
+			s, err := rb.statements()
+			if err != nil {
+				return nil, fmt.Errorf("changeset `%v`: %w", cs.ID, err)
+			}
+
+			stmts = append(stmts, s...)
+		}
+
+		return stmts, nil
+	}
+
+	var stmts []Statement
+	for i := len(cs.Changes) - 1; i >= 0; i-- {
+		r, ok := cs.Changes[i].(Reversible)
+		if !ok {
+			return nil, fmt.Errorf("changeset `%v` by %v: %w, <%v> can't be rolled back automatically", cs.ID, cs.Author, ErrNoRollback, changeName(cs.Changes[i]))
+		}
+
+		reverse, err := r.Reverse()
+		if err != nil {
+			return nil, fmt.Errorf("changeset `%v` by %v: %w, %v", cs.ID, cs.Author, ErrNoRollback, err)
+		}
+
+		for _, c := range reverse {
+			s, err := c.Statements()
+			if err != nil {
+				return nil, fmt.Errorf("changeset `%v`: %w", cs.ID, err)
+			}
+
+			stmts = append(stmts, s...)
+		}
+	}
+
+	return stmts, nil
+}
+
+// description summarizes the changes of the changeset
+// with their element names, like Liquibase does.
+func (cs ChangeSet) description() string {
+	names := make([]string, 0, len(cs.Changes))
+	for _, c := range cs.Changes {
+		names = append(names, changeName(c))
+	}
+
+	return truncate(strings.Join(names, "; "), 255)
+}
+
+// truncate cuts s to n characters, the size
+// of the databasechangelog varchar columns.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+
+	return s
+}
+
+// nullable returns nil for empty strings so
+// these are stored as NULL.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
 // sql concats the sql statements on the SQL array of the
 // changeset.
 func (cs ChangeSet) sql() string {
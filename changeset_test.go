@@ -1,8 +1,14 @@
 package liquo
 
 import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,3 +22,685 @@ func TestSQLFunc(t *testing.T) {
 
 	r.Equal(c.sql(), "SELECT 1;\nSELECT 2;")
 }
+
+func TestCreateTableStatements(t *testing.T) {
+	r := require.New(t)
+	data := `
+	<changeSet id="1" author="ox">
+		<createTable tableName="users" schemaName="public" remarks="The users">
+			<column name="id" type="uuid" defaultValueComputed="gen_random_uuid()">
+				<constraints primaryKey="true" primaryKeyName="users_pk"/>
+			</column>
+			<column name="email" type="varchar(255)">
+				<constraints nullable="false" unique="true"/>
+			</column>
+			<column name="active" type="boolean" defaultValueBoolean="true"/>
+			<column name="bio" type="clob" defaultValue="it's me" remarks="About the user"/>
+			<column name="org_id" type="uuid">
+				<constraints references="orgs(id)" foreignKeyName="users_org_fk" deleteCascade="true"/>
+			</column>
+			<column name="created_at" type="datetime"/>
+		</createTable>
+		<sql>SELECT 1;</sql>
+	</changeSet>`
+
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(data), &cs))
+	r.Len(cs.Changes, 2)
+	r.IsType(&CreateTable{}, cs.Changes[0])
+	r.IsType(&RawSQL{}, cs.Changes[1])
+
+	stmts, err := cs.statements()
+	r.NoError(err)
+	r.Len(stmts, 4)
+	r.Equal(`CREATE TABLE public.users (
+	id uuid DEFAULT gen_random_uuid() NOT NULL,
+	email varchar(255) NOT NULL UNIQUE,
+	active boolean DEFAULT TRUE,
+	bio TEXT DEFAULT 'it''s me',
+	org_id uuid,
+	created_at TIMESTAMP WITHOUT TIME ZONE,
+	CONSTRAINT users_pk PRIMARY KEY (id),
+	CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+)`, stmts[0].SQL)
+	r.Equal(`COMMENT ON TABLE public.users IS 'The users'`, stmts[1].SQL)
+	r.Equal(`COMMENT ON COLUMN public.users.bio IS 'About the user'`, stmts[2].SQL)
+	r.Equal(`SELECT 1;`, stmts[3].SQL)
+}
+
+func TestUnsupportedChange(t *testing.T) {
+	r := require.New(t)
+	data := `<changeSet id="1" author="ox"><createSequence sequenceName="seq"/></changeSet>`
+
+	cs := ChangeSet{}
+	err := xml.Unmarshal([]byte(data), &cs)
+	r.Error(err)
+	r.Contains(err.Error(), "createSequence")
+}
+
+func TestColumnChangesStatements(t *testing.T) {
+	r := require.New(t)
+	data := `
+	<changeSet id="1" author="ox">
+		<addColumn tableName="users" schemaName="app">
+			<column name="nickname" type="nvarchar(50)" defaultValue="none"/>
+			<column name="team_id" type="uuid">
+				<constraints nullable="false" references="teams(id)"/>
+			</column>
+		</addColumn>
+		<dropColumn tableName="users" columnName="legacy"/>
+		<dropColumn tableName="users">
+			<column name="a"/>
+			<column name="b"/>
+		</dropColumn>
+		<renameColumn tableName="users" oldColumnName="nickname" newColumnName="alias"/>
+		<modifyDataType tableName="users" columnName="age" newDataType="bigint"/>
+	</changeSet>`
+
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(data), &cs))
+	r.Len(cs.Changes, 5)
+
+	stmts, err := cs.statements()
+	r.NoError(err)
+	r.Len(stmts, 5)
+	r.Equal(`ALTER TABLE app.users ADD COLUMN nickname VARCHAR(50) DEFAULT 'none', ADD COLUMN team_id uuid NOT NULL, ADD FOREIGN KEY (team_id) REFERENCES teams(id)`, stmts[0].SQL)
+	r.Equal(`ALTER TABLE users DROP COLUMN legacy`, stmts[1].SQL)
+	r.Equal(`ALTER TABLE users DROP COLUMN a, DROP COLUMN b`, stmts[2].SQL)
+	r.Equal(`ALTER TABLE users RENAME COLUMN nickname TO alias`, stmts[3].SQL)
+	r.Equal(`ALTER TABLE users ALTER COLUMN age TYPE bigint USING (age::bigint)`, stmts[4].SQL)
+}
+
+func TestIndexAndConstraintStatements(t *testing.T) {
+	r := require.New(t)
+	data := `
+	<changeSet id="1" author="ox">
+		<createIndex indexName="users_email_idx" tableName="users" unique="true" clustered="true">
+			<column name="email"/>
+			<column name="created_at" descending="true"/>
+		</createIndex>
+		<dropIndex indexName="old_idx" schemaName="app" tableName="users"/>
+		<addPrimaryKey tableName="roles" columnNames="user_id,role"/>
+		<dropPrimaryKey tableName="roles"/>
+		<addUniqueConstraint tableName="users" columnNames="email, org_id" constraintName="users_email_uq" deferrable="true" initiallyDeferred="true"/>
+		<dropUniqueConstraint tableName="users" constraintName="users_email_uq"/>
+		<addForeignKeyConstraint baseTableName="users" baseColumnNames="org_id" referencedTableName="orgs" referencedColumnNames="id" constraintName="users_org_fk" onDelete="SET NULL" onUpdate="CASCADE"/>
+		<dropForeignKeyConstraint baseTableName="users" constraintName="users_org_fk"/>
+		<addNotNullConstraint tableName="users" columnName="name" defaultNullValue="unknown"/>
+		<dropNotNullConstraint tableName="users" columnName="name"/>
+		<addDefaultValue tableName="users" columnName="active" defaultValueBoolean="false"/>
+		<dropDefaultValue tableName="users" columnName="active"/>
+	</changeSet>`
+
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(data), &cs))
+	r.Len(cs.Changes, 12)
+
+	stmts, err := cs.statements()
+	r.NoError(err)
+
+	var sqls []string
+	for _, s := range stmts {
+		sqls = append(sqls, s.SQL)
+	}
+
+	r.Equal([]string{
+		`CREATE UNIQUE INDEX users_email_idx ON users (email, created_at DESC)`,
+		`CLUSTER users USING users_email_idx`,
+		`DROP INDEX app.old_idx`,
+		`ALTER TABLE roles ADD PRIMARY KEY (user_id, role)`,
+		`ALTER TABLE roles DROP CONSTRAINT roles_pkey`,
+		`ALTER TABLE users ADD CONSTRAINT users_email_uq UNIQUE (email, org_id) DEFERRABLE INITIALLY DEFERRED`,
+		`ALTER TABLE users DROP CONSTRAINT users_email_uq`,
+		`ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id) ON DELETE SET NULL ON UPDATE CASCADE`,
+		`ALTER TABLE users DROP CONSTRAINT users_org_fk`,
+		`UPDATE users SET name = $1 WHERE name IS NULL`,
+		`ALTER TABLE users ALTER COLUMN name SET NOT NULL`,
+		`ALTER TABLE users ALTER COLUMN name DROP NOT NULL`,
+		`ALTER TABLE users ALTER COLUMN active SET DEFAULT FALSE`,
+		`ALTER TABLE users ALTER COLUMN active DROP DEFAULT`,
+	}, sqls)
+	r.Equal([]any{"unknown"}, stmts[9].Args)
+}
+
+func TestRollbackStatements(t *testing.T) {
+	t.Run("inferred", func(t *testing.T) {
+		r := require.New(t)
+		data := `
+		<changeSet id="1" author="ox">
+			<createTable tableName="users">
+				<column name="id" type="int"/>
+			</createTable>
+			<addColumn tableName="users">
+				<column name="email" type="text"/>
+			</addColumn>
+			<renameColumn tableName="users" oldColumnName="email" newColumnName="mail"/>
+			<createIndex tableName="users" indexName="users_mail_idx">
+				<column name="mail"/>
+			</createIndex>
+			<addForeignKeyConstraint baseTableName="users" baseColumnNames="org_id" referencedTableName="orgs" referencedColumnNames="id" constraintName="users_org_fk"/>
+		</changeSet>`
+
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		stmts, err := cs.rollbackStatements()
+		r.NoError(err)
+
+		var sqls []string
+		for _, s := range stmts {
+			sqls = append(sqls, s.SQL)
+		}
+
+		r.Equal([]string{
+			`ALTER TABLE users DROP CONSTRAINT users_org_fk`,
+			`DROP INDEX users_mail_idx`,
+			`ALTER TABLE users RENAME COLUMN mail TO email`,
+			`ALTER TABLE users DROP COLUMN email`,
+			`DROP TABLE users`,
+		}, sqls)
+	})
+
+	t.Run("explicit", func(t *testing.T) {
+		r := require.New(t)
+		data := `<changeSet id="1" author="ox"><sql>SELECT 1;</sql><rollback>SELECT 2;</rollback></changeSet>`
+
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		stmts, err := cs.rollbackStatements()
+		r.NoError(err)
+		r.Equal([]Statement{{SQL: "SELECT 2;"}}, stmts)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		r := require.New(t)
+		data := `<changeSet id="1" author="ox"><sql>SELECT 1;</sql><rollback></rollback></changeSet>`
+
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		stmts, err := cs.rollbackStatements()
+		r.NoError(err)
+		r.Empty(stmts)
+	})
+
+	t.Run("not reversible", func(t *testing.T) {
+		r := require.New(t)
+		data := `<changeSet id="drop-users" author="ox"><dropTable tableName="users"/></changeSet>`
+
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		_, err := cs.rollbackStatements()
+		r.ErrorIs(err, ErrNoRollback)
+		r.Contains(err.Error(), "drop-users")
+		r.Contains(err.Error(), "dropTable")
+	})
+}
+
+func TestDataChangesStatements(t *testing.T) {
+	r := require.New(t)
+	data := `
+	<changeSet id="1" author="ox">
+		<insert tableName="countries" schemaName="ref">
+			<column name="code" value="CO"/>
+			<column name="population" valueNumeric="50882891"/>
+			<column name="active" valueBoolean="true"/>
+			<column name="founded" valueDate="1810-07-20"/>
+			<column name="created_at" valueComputed="now()"/>
+			<column name="notes"/>
+		</insert>
+		<update tableName="countries">
+			<column name="name" value="Colombia"/>
+			<column name="updated_at" valueComputed="now()"/>
+			<where>code = 'CO'</where>
+		</update>
+		<delete tableName="countries">
+			<where>code = 'XX'</where>
+		</delete>
+	</changeSet>`
+
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(data), &cs))
+	r.Len(cs.Changes, 3)
+
+	stmts, err := cs.statements()
+	r.NoError(err)
+	r.Len(stmts, 3)
+
+	r.Equal(`INSERT INTO ref.countries (code, population, active, founded, created_at, notes) VALUES ($1, $2, $3, $4, now(), NULL)`, stmts[0].SQL)
+	r.Equal([]any{"CO", "50882891", true, "1810-07-20"}, stmts[0].Args)
+
+	r.Equal(`UPDATE countries SET name = $1, updated_at = now() WHERE code = 'CO'`, stmts[1].SQL)
+	r.Equal([]any{"Colombia"}, stmts[1].Args)
+
+	r.Equal(`DELETE FROM countries WHERE code = 'XX'`, stmts[2].SQL)
+	r.Empty(stmts[2].Args)
+
+	_, err = cs.rollbackStatements()
+	r.ErrorIs(err, ErrNoRollback)
+}
+
+func TestLoadDataStatements(t *testing.T) {
+	dir := t.TempDir()
+	migration := filepath.Join(dir, "migration.xml")
+	csv := "# reference data\ncode;name;population;created_at;ignored\nCO;'Colombia';50882891;now();x\nUS;'United ''States''';NULL;now();y\n"
+	err := os.WriteFile(filepath.Join(dir, "countries.csv"), []byte(csv), 0644)
+	require.NoError(t, err)
+
+	t.Run("loadData", func(t *testing.T) {
+		r := require.New(t)
+		data := `
+		<changeSet id="1" author="ox">
+			<loadData tableName="countries" file="countries.csv" relativeToChangelogFile="true" separator=";" quotchar="'" commentLineStartsWith="#">
+				<column name="created_at" type="COMPUTED"/>
+				<column name="ignored" type="SKIP"/>
+			</loadData>
+		</changeSet>`
+
+		m := &Migration{}
+		r.NoError(xml.Unmarshal([]byte(`<databaseChangeLog>`+data+`</databaseChangeLog>`), m))
+		m.resolve(migration)
+
+		stmts, err := m.ChangeSets[0].statements()
+		r.NoError(err)
+		r.Equal([]Statement{
+			{SQL: `INSERT INTO countries (code, name, population, created_at) VALUES ($1, $2, $3, now())`, Args: []any{"CO", "Colombia", "50882891"}},
+			{SQL: `INSERT INTO countries (code, name, population, created_at) VALUES ($1, $2, NULL, now())`, Args: []any{"US", "United 'States'"}},
+		}, stmts)
+	})
+
+	t.Run("loadUpdateData", func(t *testing.T) {
+		r := require.New(t)
+		data := `
+		<changeSet id="1" author="ox">
+			<loadUpdateData tableName="countries" file="countries.csv" relativeToChangelogFile="true" separator=";" quotchar="'" commentLineStartsWith="#" primaryKey="code">
+				<column name="country_name" header="name"/>
+				<column name="created_at" type="SKIP"/>
+				<column name="ignored" type="SKIP"/>
+			</loadUpdateData>
+		</changeSet>`
+
+		m := &Migration{}
+		r.NoError(xml.Unmarshal([]byte(`<databaseChangeLog>`+data+`</databaseChangeLog>`), m))
+		m.resolve(migration)
+
+		stmts, err := m.ChangeSets[0].statements()
+		r.NoError(err)
+		r.Len(stmts, 2)
+		r.Equal(`INSERT INTO countries (code, country_name, population) VALUES ($1, $2, $3) ON CONFLICT (code) DO UPDATE SET country_name = EXCLUDED.country_name, population = EXCLUDED.population`, stmts[0].SQL)
+		r.Equal([]any{"CO", "Colombia", "50882891"}, stmts[0].Args)
+	})
+
+	t.Run("column types", func(t *testing.T) {
+		r := require.New(t)
+		typed := "code,active,population,founded,updated_at\nCO,1,50882891.5,1810-07-20,2024-05-14 10:30:00.5\n"
+		r.NoError(os.WriteFile(filepath.Join(dir, "typed.csv"), []byte(typed), 0644))
+
+		load := func(columns string) ([]Statement, error) {
+			ld := &LoadData{}
+			r.NoError(xml.Unmarshal([]byte(`<loadData tableName="countries" file="typed.csv" relativeToChangelogFile="true">`+columns+`</loadData>`), ld))
+			ld.resolve(migration)
+
+			return ld.Statements()
+		}
+
+		stmts, err := load(`
+			<column name="active" type="BOOLEAN"/>
+			<column name="population" type="NUMERIC"/>
+			<column name="founded" type="DATE"/>
+			<column name="updated_at" type="DATETIME"/>`)
+		r.NoError(err)
+		r.Equal([]any{"CO", "true", "50882891.5", "1810-07-20", "2024-05-14 10:30:00.5"}, stmts[0].Args)
+
+		_, err = load(`<column name="code" type="NUMERIC"/>`)
+		r.ErrorContains(err, `typed.csv line 2 column code: invalid NUMERIC "CO"`)
+
+		_, err = load(`<column name="code" type="BLOB"/>`)
+		r.ErrorContains(err, "column code: unsupported type BLOB")
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		r := require.New(t)
+		data := `
+		<changeSet id="1" author="ox">
+			<sql>DELETE FROM countries;</sql>
+			<rollback>
+				<loadData tableName="countries" file="countries.csv" relativeToChangelogFile="true" separator=";" quotchar="'" commentLineStartsWith="#">
+					<column name="created_at" type="COMPUTED"/>
+					<column name="ignored" type="SKIP"/>
+				</loadData>
+			</rollback>
+		</changeSet>`
+
+		m := &Migration{}
+		r.NoError(xml.Unmarshal([]byte(`<databaseChangeLog>`+data+`</databaseChangeLog>`), m))
+		m.resolve(migration)
+
+		stmts, err := m.ChangeSets[0].rollbackStatements()
+		r.NoError(err)
+		r.Len(stmts, 2)
+	})
+}
+
+func TestReadCSV(t *testing.T) {
+	r := require.New(t)
+	data := "a,b,c\r\n\"1,5\",\"say \"\"hi\"\"\",\n\n\"multi\nline\",x,y"
+
+	records, err := readCSV(strings.NewReader(data), ',', '"', "")
+	r.NoError(err)
+	r.Equal([][]string{
+		{"a", "b", "c"},
+		{"1,5", `say "hi"`, ""},
+		{"multi\nline", "x", "y"},
+	}, records)
+
+	_, err = readCSV(strings.NewReader(`"open`), ',', '"', "")
+	r.Error(err)
+
+	records, err = readCSV(strings.NewReader("§§ comment\n§a,b\n"), ',', '"', "§§")
+	r.NoError(err)
+	r.Equal([][]string{{"§a", "b"}}, records)
+}
+
+func TestChecksum(t *testing.T) {
+	r := require.New(t)
+	parse := func(data string) ChangeSet {
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		return cs
+	}
+
+	base := parse(`<changeSet id="1" author="ox"><sql>SELECT 1;</sql><createTable tableName="a"><column name="id" type="int"/></createTable></changeSet>`)
+	r.Regexp(`^9:[0-9a-f]{32}$`, base.Checksum())
+
+	formatted := parse(`<changeSet id="1" author="other">
+		<comment>Formatting and comments don't matter</comment>
+		<sql>
+			SELECT   1;
+		</sql>
+		<createTable tableName="a">
+			<column type="int" name="id"/>
+		</createTable>
+		<rollback>DROP TABLE a;</rollback>
+	</changeSet>`)
+	r.Equal(base.Checksum(), formatted.Checksum())
+
+	changed := parse(`<changeSet id="1" author="ox"><sql>SELECT 1;</sql><createTable tableName="a"><column name="id" type="bigint"/></createTable></changeSet>`)
+	r.NotEqual(base.Checksum(), changed.Checksum())
+
+	reordered := parse(`<changeSet id="1" author="ox"><createTable tableName="a"><column name="id" type="int"/></createTable><sql>SELECT 1;</sql></changeSet>`)
+	r.NotEqual(base.Checksum(), reordered.Checksum())
+}
+
+func TestSerializeChange(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(`<changeSet id="1" author="ox">
+		<createTable tableName="users" schemaName="app">
+			<column name="id" type="int"><constraints primaryKey="true" nullable="false"/></column>
+			<column name="name" type="varchar(255)"/>
+		</createTable>
+		<sql>SELECT 1;</sql>
+	</changeSet>`), &cs))
+
+	r.Equal(`createTable:[
+    columns=[
+        [
+            [
+                nullable="false"
+                primaryKey="true"
+            ]
+            name="id"
+            type="int"
+        ],
+        [
+            name="name"
+            type="varchar(255)"
+        ]
+    ]
+    schemaName="app"
+    tableName="users"
+]`, serializeChange(cs.Changes[0]))
+	r.Equal("sql:[]", serializeChange(cs.Changes[1]))
+	r.Equal("SELECT 1; SELECT 2;", normalizeSQL("\n\tSELECT 1;\r\n  SELECT   2;  \n"))
+}
+
+func TestValidChecksum(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{ValidCheckSums: []string{" 9:abc "}}
+	r.True(cs.validChecksum("9:abc"))
+	r.False(cs.validChecksum("9:def"))
+
+	cs.ValidCheckSums = append(cs.ValidCheckSums, "ANY")
+	r.True(cs.validChecksum("9:def"))
+}
+
+func TestCheckChecksums(t *testing.T) {
+	r := require.New(t)
+	cs := func(id string) fileChangeSet {
+		return fileChangeSet{ChangeSet: ChangeSet{ID: id, Author: "ox", Changes: []Change{&RawSQL{SQL: "SELECT " + id + ";"}}}, file: "a.xml"}
+	}
+
+	unchanged, missing, modified, pending := cs("1"), cs("2"), cs("3"), cs("4")
+	h := &changeLogHistory{ran: map[string]string{
+		unchanged.key(): unchanged.Checksum(),
+		missing.key():   "",
+		modified.key():  "9:00000000000000000000000000000000",
+	}}
+
+	_, err := checkChecksums(h, []fileChangeSet{unchanged, missing, modified, pending})
+	r.ErrorIs(err, ErrChecksumMismatch)
+	r.ErrorContains(err, "a.xml::3::ox was 9:00000000000000000000000000000000 but is now "+modified.Checksum())
+
+	modified.RunOnChange = true
+
+	toStore, err := checkChecksums(h, []fileChangeSet{unchanged, missing, modified, pending})
+	r.NoError(err)
+	r.Equal([]fileChangeSet{missing}, toStore, "only changesets without a checksum get one stored")
+
+	t.Run("other versions", func(t *testing.T) {
+		r := require.New(t)
+		v8, v7 := cs("5"), cs("6")
+		h := &changeLogHistory{ran: map[string]string{
+			v8.key(): "8:00000000000000000000000000000000",
+			v7.key(): "7:00000000000000000000000000000000",
+		}}
+
+		toStore, err := checkChecksums(h, []fileChangeSet{v8, v7})
+		r.NoError(err, "checksums written by other Liquibase versions are not validated")
+		r.Empty(toStore, "checksums written by other Liquibase versions are not overwritten")
+	})
+}
+
+func TestRunAttributes(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(`<changeSet id="1" author="ox" runAlways="true" runOnChange="true" failOnError="false"><sql>SELECT 1;</sql></changeSet>`), &cs))
+	r.True(cs.RunAlways)
+	r.True(cs.RunOnChange)
+	r.NotNil(cs.FailOnError)
+	r.False(*cs.FailOnError)
+
+	cs = ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(`<changeSet id="1" author="ox"><sql>SELECT 1;</sql></changeSet>`), &cs))
+	r.False(cs.RunAlways)
+	r.Nil(cs.FailOnError)
+}
+
+func TestMigrationFilename(t *testing.T) {
+	r := require.New(t)
+	m := Migration{}
+	r.NoError(xml.Unmarshal([]byte(`<databaseChangeLog logicalFilePath="db/users.xml">
+		<changeSet id="1" author="ox"><sql>SELECT 1;</sql></changeSet>
+		<changeSet id="2" author="ox" logicalFilePath="db/other.xml"><sql>SELECT 2;</sql></changeSet>
+	</databaseChangeLog>`), &m))
+
+	r.Equal("db/users.xml", m.filename(m.ChangeSets[0], "migrations/users.xml"))
+	r.Equal("db/other.xml", m.filename(m.ChangeSets[1], "migrations/users.xml"))
+	r.Equal("migrations/users.xml", Migration{}.filename(m.ChangeSets[0], "migrations/users.xml"))
+	r.Equal("db/users.xml::1::ox", changeSetKey("db/users.xml", "1", "ox"))
+}
+
+func TestDescription(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(`<changeSet id="1" author="ox">
+		<comment>Creates the users table</comment>
+		<createTable tableName="users"><column name="id" type="int"/></createTable>
+		<sql>SELECT 1;</sql>
+	</changeSet>`), &cs))
+
+	r.Equal("createTable; sql", cs.description())
+	r.Equal("Creates the users table", cs.Comment)
+	r.Equal("abc", truncate("abcdef", 3))
+	r.Len(deploymentID(), 10)
+}
+
+func TestTagDatabase(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(`<changeSet id="1" author="ox"><tagDatabase tag="v1.2"/></changeSet>`), &cs))
+	r.Equal("v1.2", cs.tag())
+
+	stmts, err := cs.statements()
+	r.NoError(err)
+	r.Empty(stmts)
+
+	stmts, err = cs.rollbackStatements()
+	r.NoError(err)
+	r.Empty(stmts)
+
+	r.Equal("", ChangeSet{}.tag())
+
+	_, err = TagDatabase{}.Statements()
+	r.Error(err)
+}
+
+func TestTransaction(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	// Savepoints can only be created in transactions.
+	inTransaction := func(cs ChangeSet) bool {
+		var in bool
+		r.NoError(cs.transaction(ctx, conn, func(conn *pgx.Conn) error {
+			_, err := conn.Exec(ctx, `SAVEPOINT liquo`)
+			in = err == nil
+
+			return nil
+		}))
+
+		return in
+	}
+
+	no, yes := false, true
+	r.True(inTransaction(ChangeSet{}))
+	r.True(inTransaction(ChangeSet{RunInTransaction: &yes}))
+	r.False(inTransaction(ChangeSet{RunInTransaction: &no}))
+}
+
+func TestExecuteRecordsInTransaction(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	drop := func() {
+		_, err := conn.Exec(ctx, `DROP TABLE IF EXISTS liquo_transaction`)
+		require.NoError(t, err)
+	}
+
+	drop()
+	t.Cleanup(drop)
+
+	exists := func() bool {
+		var exists bool
+		require.NoError(t, conn.QueryRow(ctx, `SELECT to_regclass('liquo_transaction') IS NOT NULL`).Scan(&exists))
+
+		return exists
+	}
+
+	recorded := func() int {
+		var count int
+		require.NoError(t, conn.QueryRow(ctx, `SELECT count(*) FROM databasechangelog`).Scan(&count))
+
+		return count
+	}
+
+	// Ids longer than the id column make recording the changeset fail
+	// after its changes ran.
+	cs := ChangeSet{ID: strings.Repeat("x", 300), Author: "ox", Changes: []Change{&RawSQL{SQL: "CREATE TABLE liquo_transaction (id int)"}}}
+
+	t.Run("in transaction", func(t *testing.T) {
+		r := require.New(t)
+		r.Error(cs.Execute(conn, "a.xml"))
+		r.False(exists(), "the changes are rolled back with the record")
+		r.Zero(recorded())
+
+		cs.ID = "1"
+		r.NoError(cs.Execute(conn, "a.xml"))
+		r.True(exists())
+		r.Equal(1, recorded())
+		drop()
+	})
+
+	t.Run("runInTransaction false", func(t *testing.T) {
+		r := require.New(t)
+		no := false
+		cs.ID = strings.Repeat("x", 300)
+		cs.RunInTransaction = &no
+
+		r.Error(cs.Execute(conn, "a.xml"))
+		r.True(exists(), "the changes are not rolled back")
+		r.Equal(1, recorded())
+	})
+}
+
+func TestFailOnErrorFalse(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	drop := func() {
+		_, err := conn.Exec(ctx, `DROP TABLE IF EXISTS liquo_failed`)
+		r.NoError(err)
+	}
+
+	drop()
+	t.Cleanup(drop)
+
+	no := false
+	cs := ChangeSet{ID: "1", Author: "ox", FailOnError: &no, Changes: []Change{&RawSQL{SQL: "CREATE TABLE liquo_failed (id int); SELECT * FROM missing_table;"}}}
+
+	h, err := loadHistory(ctx, conn)
+	r.NoError(err)
+	r.NoError(cs.execute(ctx, conn, "a.xml", h))
+
+	h, err = loadHistory(ctx, conn)
+	r.NoError(err)
+	r.True(h.pending(cs, "a.xml"), "FAILED changesets are pending")
+
+	keys, err := Command{steps: 1}.rollbackKeys(ctx, conn)
+	r.NoError(err)
+	r.Empty(keys, "FAILED changesets are not rolled back")
+
+	cs.Changes = []Change{&RawSQL{SQL: "CREATE TABLE liquo_failed (id int);"}}
+	r.NoError(cs.execute(ctx, conn, "a.xml", h))
+
+	var exectypes []string
+	rows, err := conn.Query(ctx, `SELECT exectype FROM databasechangelog`)
+	r.NoError(err)
+	for rows.Next() {
+		var exectype string
+		r.NoError(rows.Scan(&exectype))
+		exectypes = append(exectypes, exectype)
+	}
+	r.NoError(rows.Err())
+	r.Equal([]string{"EXECUTED"}, exectypes, "the FAILED row is updated when it succeeds")
+
+	keys, err = Command{steps: 1}.rollbackKeys(ctx, conn)
+	r.NoError(err)
+	r.Equal([]string{"a.xml::1::ox"}, keys)
+}
@@ -0,0 +1,167 @@
+package liquo
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// checksumVersion is the Liquibase checksum algorithm liquo implements,
+// checksums are stored as [version]:[md5] like Liquibase does.
+const checksumVersion = "9"
+
+// Checksum of the changeset in the 9:[md5] format of Liquibase 4.24 and
+// later. Like Liquibase, it is computed from the checksums of each one of
+// the changes, so comments, rollbacks and formatting don't change it.
+func (cs ChangeSet) Checksum() string {
+	var b strings.Builder
+	for _, c := range cs.Changes {
+		b.WriteString(changeChecksum(c))
+		b.WriteString(":")
+	}
+
+	return computeChecksum(b.String())
+}
+
+// changeChecksum computes the checksum of a single change the way
+// Liquibase does, from the change serialized with its attributes sorted.
+// SQL is normalized so whitespace doesn't affect it and the contents of
+// CSV files are part of the checksum of the changes that load them.
+func changeChecksum(c Change) string {
+	checksum := computeChecksum(serializeChange(c))
+	if r, ok := c.(*RawSQL); ok {
+		return computeChecksum(checksum + ":" + checksumVersion + ":" + md5Hex(normalizeSQL(r.SQL)))
+	}
+
+	if f, ok := c.(interface{ contents() ([]byte, error) }); ok {
+		// Files that can't be read are reported when executing, the
+		// checksum is computed from the change alone.
+		if data, err := f.contents(); err == nil {
+			content := strings.ReplaceAll(string(data), "\r", "")
+			return computeChecksum(checksum + ":" + checksumVersion + ":" + md5Hex(content))
+		}
+	}
+
+	return checksum
+}
+
+// computeChecksum returns the checksum of the value with its line
+// endings standardized and in NFC form, like Liquibase's CheckSum.compute.
+func computeChecksum(value string) string {
+	value = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\uFFFD", "").Replace(value)
+
+	return checksumVersion + ":" + md5Hex(norm.NFC.String(value))
+}
+
+// normalizeSQL collapses the whitespace of the SQL into single
+// spaces and trims it, so formatting doesn't change the checksum.
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.FieldsFunc(sql, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}), " ")
+}
+
+// serializeChange writes the change in the format of Liquibase's
+// StringChangeLogSerializer, the name of the change followed by
+// its fields sorted and indented.
+func serializeChange(c Change) string {
+	return changeName(c) + ":" + serializeObject(reflect.ValueOf(c), 1)
+}
+
+// serializeObject writes the fields of the struct as name="value" lines.
+// Like in Liquibase, nested objects go without their name and lists of
+// objects as name=[...].
+func serializeObject(v reflect.Value, indent int) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	var values []string
+	collectFields(v, indent, &values)
+	sort.Strings(values)
+	values = unique(values)
+
+	if len(values) == 0 {
+		return "[" + indentation(indent-1) + "]"
+	}
+
+	return "[\n" + strings.Join(values, "\n") + "\n" + indentation(indent-1) + "]"
+}
+
+// collectFields appends the serialized xml fields of the struct into
+// values, going into embedded structs. Empty values are left out.
+func collectFields(v reflect.Value, indent int, values *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, value := t.Field(i), v.Field(i)
+		if f.Anonymous {
+			collectFields(value, indent, values)
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("xml"), ",")[0]
+		if name == "" || name == "-" || value.IsZero() {
+			continue
+		}
+
+		for value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+
+		switch value.Kind() {
+		case reflect.Struct:
+			*values = append(*values, indentation(indent)+serializeObject(value, indent+1))
+		case reflect.Slice:
+			*values = append(*values, indentation(indent)+serializedName(name)+"="+serializeList(value, indent+1))
+		default:
+			*values = append(*values, indentation(indent)+serializedName(name)+`="`+fmt.Sprint(value.Interface())+`"`)
+		}
+	}
+}
+
+// serializeList writes the objects of the list one per line.
+func serializeList(v reflect.Value, indent int) string {
+	items := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		items = append(items, indentation(indent)+serializeObject(v.Index(i), indent+1))
+	}
+
+	return "[\n" + strings.Join(items, ",\n") + "\n" + indentation(indent-1) + "]"
+}
+
+// serializedName returns the name Liquibase gives the field
+// of an xml element, the <column> elements go in columns.
+func serializedName(name string) string {
+	if name == "column" {
+		return "columns"
+	}
+
+	return name
+}
+
+func indentation(indent int) string {
+	return strings.Repeat(" ", 4*indent)
+}
+
+// unique removes the repeated values of the sorted slice.
+func unique(values []string) []string {
+	var result []string
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package liquo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Column is the Liquibase <column> element, it is shared by the
+// changes that need to describe columns like createTable or insert.
+type Column struct {
+	Name          string `xml:"name,attr"`
+	Type          string `xml:"type,attr"`
+	AutoIncrement bool   `xml:"autoIncrement,attr"`
+	Remarks       string `xml:"remarks,attr"`
+	Descending    bool   `xml:"descending,attr"`
+	Header        string `xml:"header,attr"`
+
+	Value         *string `xml:"value,attr"`
+	ValueNumeric  string  `xml:"valueNumeric,attr"`
+	ValueBoolean  *bool   `xml:"valueBoolean,attr"`
+	ValueDate     string  `xml:"valueDate,attr"`
+	ValueComputed string  `xml:"valueComputed,attr"`
+
+	DefaultValues
+	Constraints *Constraints `xml:"constraints"`
+}
+
+// DefaultValues are the defaultValue* attributes, used by
+// columns and by the addDefaultValue change.
+type DefaultValues struct {
+	DefaultValue         *string `xml:"defaultValue,attr"`
+	DefaultValueNumeric  string  `xml:"defaultValueNumeric,attr"`
+	DefaultValueBoolean  *bool   `xml:"defaultValueBoolean,attr"`
+	DefaultValueDate     string  `xml:"defaultValueDate,attr"`
+	DefaultValueComputed string  `xml:"defaultValueComputed,attr"`
+}
+
+// Constraints of a column, these are the attributes of the
+// Liquibase <constraints> element.
+type Constraints struct {
+	Nullable             *bool  `xml:"nullable,attr"`
+	PrimaryKey           bool   `xml:"primaryKey,attr"`
+	PrimaryKeyName       string `xml:"primaryKeyName,attr"`
+	Unique               bool   `xml:"unique,attr"`
+	UniqueConstraintName string `xml:"uniqueConstraintName,attr"`
+
+	References            string `xml:"references,attr"`
+	ReferencedTableName   string `xml:"referencedTableName,attr"`
+	ReferencedColumnNames string `xml:"referencedColumnNames,attr"`
+	ForeignKeyName        string `xml:"foreignKeyName,attr"`
+	DeleteCascade         bool   `xml:"deleteCascade,attr"`
+}
+
+// definition of the column as it goes in a CREATE TABLE or
+// ADD COLUMN statement.
+func (c Column) definition() string {
+	def := []string{c.Name, pgType(c.Type)}
+	if c.AutoIncrement {
+		def = append(def, "GENERATED BY DEFAULT AS IDENTITY")
+	}
+
+	if value, ok := c.defaultValue(); ok {
+		def = append(def, "DEFAULT "+value)
+	}
+
+	if c.Constraints == nil {
+		return strings.Join(def, " ")
+	}
+
+	if (c.Constraints.Nullable != nil && !*c.Constraints.Nullable) || c.Constraints.PrimaryKey {
+		def = append(def, "NOT NULL")
+	}
+
+	if c.Constraints.Unique {
+		if c.Constraints.UniqueConstraintName != "" {
+			def = append(def, "CONSTRAINT "+c.Constraints.UniqueConstraintName)
+		}
+
+		def = append(def, "UNIQUE")
+	}
+
+	return strings.Join(def, " ")
+}
+
+// defaultValue returns the SQL for the default value
+// and whether there is one.
+func (d DefaultValues) defaultValue() (string, bool) {
+	switch {
+	case d.DefaultValueComputed != "":
+		return d.DefaultValueComputed, true
+	case d.DefaultValueNumeric != "":
+		return d.DefaultValueNumeric, true
+	case d.DefaultValueBoolean != nil:
+		return boolSQL(*d.DefaultValueBoolean), true
+	case d.DefaultValueDate != "":
+		return quote(d.DefaultValueDate), true
+	case d.DefaultValue != nil:
+		return quote(*d.DefaultValue), true
+	}
+
+	return "", false
+}
+
+// value returns the SQL for the value of the column in an insert or
+// update. Values are appended to args and referenced with a placeholder,
+// computed values go into the SQL as they are.
+func (c Column) value(args []any) (string, []any) {
+	var arg any
+	switch {
+	case c.ValueComputed != "":
+		return c.ValueComputed, args
+	case c.ValueNumeric != "":
+		arg = c.ValueNumeric
+	case c.ValueBoolean != nil:
+		arg = *c.ValueBoolean
+	case c.ValueDate != "":
+		arg = c.ValueDate
+	case c.Value != nil:
+		arg = *c.Value
+	default:
+		return "NULL", args
+	}
+
+	args = append(args, arg)
+
+	return fmt.Sprintf("$%d", len(args)), args
+}
+
+// foreignKey returns the FOREIGN KEY clause for the column
+// when its constraints reference another table.
+func (c Column) foreignKey() string {
+	if c.Constraints == nil {
+		return ""
+	}
+
+	references := c.Constraints.References
+	if references == "" && c.Constraints.ReferencedTableName != "" {
+		references = c.Constraints.ReferencedTableName + "(" + c.Constraints.ReferencedColumnNames + ")"
+	}
+
+	if references == "" {
+		return ""
+	}
+
+	clause := "FOREIGN KEY (" + c.Name + ") REFERENCES " + references
+	if c.Constraints.ForeignKeyName != "" {
+		clause = "CONSTRAINT " + c.Constraints.ForeignKeyName + " " + clause
+	}
+
+	if c.Constraints.DeleteCascade {
+		clause += " ON DELETE CASCADE"
+	}
+
+	return clause
+}
+
+// columnList normalizes a comma separated list of
+// column names like the ones in columnNames attributes.
+func columnList(names string) string {
+	parts := strings.Split(names, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func boolSQL(b bool) string {
+	if b {
+		return "TRUE"
+	}
+
+	return "FALSE"
+}
+
+// pgTypes translates the database agnostic types used in Liquibase
+// changelogs into their PostgreSQL counterparts.
+var pgTypes = map[string]string{
+	"DATETIME":   "TIMESTAMP WITHOUT TIME ZONE",
+	"TINYINT":    "SMALLINT",
+	"MEDIUMINT":  "INTEGER",
+	"DOUBLE":     "DOUBLE PRECISION",
+	"CLOB":       "TEXT",
+	"MEDIUMTEXT": "TEXT",
+	"LONGTEXT":   "TEXT",
+	"NCLOB":      "TEXT",
+	"BLOB":       "BYTEA",
+	"LONGBLOB":   "BYTEA",
+	"VARBINARY":  "BYTEA",
+	"BINARY":     "BYTEA",
+	"NVARCHAR":   "VARCHAR",
+	"NCHAR":      "CHAR",
+	"CURRENCY":   "DECIMAL",
+}
+
+// pgType returns the PostgreSQL type for a Liquibase column type,
+// types that need no translation are returned as they are.
+func pgType(t string) string {
+	t = strings.TrimPrefix(strings.TrimSpace(t), "java.sql.Types.")
+	base, size := t, ""
+	if i := strings.Index(t, "("); i > 0 {
+		base, size = t[:i], t[i:]
+	}
+
+	pg, ok := pgTypes[strings.ToUpper(base)]
+	if !ok {
+		return t
+	}
+
+	if pg == "BYTEA" || pg == "TEXT" || pg == "TIMESTAMP WITHOUT TIME ZONE" {
+		return pg
+	}
+
+	return pg + size
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gobuffalo/pop/v6"
 	"github.com/jackc/pgx/v5"
@@ -26,13 +28,35 @@ var (
 	createInstruction string
 )
 
-var ErrInvalidInstruction = errors.New("Invalid instruction please specify up or down")
+var ErrInvalidInstruction = errors.New("Invalid instruction please specify up, down, update-sql, status, history, tag, list-locks or release-locks")
 
 type Command struct {
 	connectionName string
 	steps          int
+	contexts       string
+	labels         string
+	lockWait       time.Duration
+	force          bool
+	exitCode       bool
+	dryRun         bool
+	outputFile     string
+	toTag          string
+	toDate         string
+	changeSet      string
+	lastDeployment bool
 	connections    map[string]*pop.Connection
 	flags          *pflag.FlagSet
+
+	// flagsErr is the error parsing the flags, Run
+	// returns it instead of running anything.
+	flagsErr error
+
+	// Filters and format of the history.
+	since  string
+	file   string
+	author string
+	tag    string
+	format string
 }
 
 func (lb Command) Name() string {
@@ -48,134 +72,151 @@ func (lb Command) HelpText() string {
 }
 
 func (lb *Command) Run(ctx context.Context, root string, args []string) error {
-	if len(args) < 3 {
-		return lb.Up()
+	if errors.Is(lb.flagsErr, pflag.ErrHelp) {
+		return nil
 	}
 
-	direction := args[2]
-	if direction == "up" {
-		return lb.Up()
+	if lb.flagsErr != nil {
+		return lb.flagsErr
 	}
 
-	if direction == "down" {
-		return lb.Rollback()
+	args = lb.positional(args)
+	if len(args) < 3 {
+		return lb.up(ctx)
+	}
+
+	switch args[2] {
+	case "up":
+		return lb.up(ctx)
+	case "update-sql":
+		return lb.UpdateSQL(ctx)
+	case "down":
+		return lb.down(ctx)
+	case "status":
+		return lb.Status(ctx)
+	case "history":
+		return lb.History(ctx)
+	case "tag":
+		if len(args) < 4 {
+			return ErrNoTagName
+		}
+
+		return lb.Tag(ctx, args[3])
+	case "list-locks":
+		return lb.ListLocks(ctx)
+	case "release-locks":
+		return lb.ReleaseLocks(ctx)
 	}
 
 	return ErrInvalidInstruction
 }
 
+// positional returns the args that are not flags or flag values, the
+// direction and the tag name are taken from these.
+func (lb Command) positional(args []string) []string {
+	if lb.flags == nil || !lb.flags.Parsed() {
+		return args
+	}
+
+	return lb.flags.Args()
+}
+
 func (lb *Command) RunBeforeTest(ctx context.Context, root string, args []string) error {
 	lb.connectionName = "test"
 
-	return lb.Up()
+	return lb.UpContext(ctx)
 }
 
-func (lb Command) Up() error {
-	cx := lb.connections[lb.connectionName]
-	if cx == nil {
-		return fmt.Errorf("connection not found")
+// up runs the pending changesets or writes
+// their SQL when --dry-run is passed.
+func (lb Command) up(ctx context.Context) error {
+	if lb.dryRun {
+		return lb.UpdateSQL(ctx)
 	}
 
-	conn, err := pgx.Connect(context.Background(), cx.URL())
+	return lb.UpContext(ctx)
+}
+
+// Up runs the pending changesets in the changelog, see UpContext.
+func (lb Command) Up() error {
+	return lb.UpContext(context.Background())
+}
+
+// UpContext runs the pending changesets in the changelog. It holds the
+// changelog lock while running so instances don't run them twice.
+func (lb Command) UpContext(ctx context.Context) (err error) {
+	conn, err := lb.connect(ctx)
 	if err != nil {
 		return err
 	}
+	defer conn.Close(context.Background())
 
-	err = lb.EnsureTables(conn)
+	err = lb.acquireLock(ctx, conn)
 	if err != nil {
 		return err
 	}
+	defer lb.deferReleaseLock(conn, &err)
 
 	cl, err := lb.ReadChangelog()
 	if err != nil {
 		return err
 	}
 
-	for _, v := range cl.Migrations {
-		// Read the file
-		m, err := lb.ReadMigration(v.File)
-		if err != nil {
-			return err
-		}
-
-		if m == nil {
-			log.Infof("[Warning] Skipping migration `%v` because its not processable by Liquo.", v.File)
-			continue
-		}
-
-		for _, mc := range m.ChangeSets {
-			err = mc.Execute(conn, v.File)
-			if err == nil {
-				continue
-			}
-
-			return fmt.Errorf("error running migration `%s`: %w", mc.ID, err)
-		}
+	changeSets, err := lb.readChangeSets(cl)
+	if err != nil {
+		return err
 	}
 
-	log.Info("Database up to date.")
-
-	return nil
-}
-
-func (lb *Command) Rollback() error {
-	cx := lb.connections[lb.connectionName]
-	if cx == nil {
-		return errors.New("connection not found")
+	h, err := loadHistory(ctx, conn)
+	if err != nil {
+		return err
 	}
 
-	conn, err := pgx.Connect(context.Background(), cx.URL())
+	err = lb.validate(ctx, conn, h, changeSets)
 	if err != nil {
 		return err
 	}
 
-	err = lb.EnsureTables(conn)
+	// When the changelog preconditions fail with CONTINUE or MARK_RAN
+	// every pending changeset is skipped or marked as ran.
+	changeLogAction, err := cl.PreConditions.verify(ctx, conn, "changelog")
 	if err != nil {
 		return err
 	}
 
-	// Default to 1 on down.
-	if lb.steps == 0 {
-		lb.steps = 1
+	pending, err := lb.pending(h, changeSets)
+	if err != nil {
+		return err
 	}
 
-	for i := 0; i < lb.steps; i++ {
-		var id, file string
-		row := conn.QueryRow(context.Background(), `SELECT filename, id FROM databasechangelog ORDER BY orderexecuted desc`)
-		err = row.Scan(&file, &id)
-		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-			return err
-		}
-
-		if errors.Is(err, pgx.ErrNoRows) {
-			log.Info("no migrations to run down.")
-
-			return nil
+	actions := map[string]string{}
+	for _, mc := range pending {
+		action := changeLogAction
+		if action == "" {
+			action, err = mc.fileAction(ctx, conn, actions)
+			if err != nil {
+				return err
+			}
 		}
 
-		m, err := lb.ReadMigration(file)
-		if err != nil {
-			return err
+		switch action {
+		case onFailContinue:
+			continue
+		case onFailMarkRan:
+			err = mc.markRan(ctx, conn, mc.file, h)
+		default:
+			err = mc.execute(ctx, conn, mc.file, h)
 		}
 
-		if m == nil {
+		if err == nil {
 			continue
 		}
 
-		for _, v := range m.ChangeSets {
-			if v.ID != id {
-				continue
-			}
-
-			err := v.Rollback(conn)
-			if err != nil {
-				log.Errorf("error rolling back `%v`.\n", v.ID)
-
-				return err
-			}
-		}
+		return fmt.Errorf("error running migration `%s`: %w", mc.ID, err)
 	}
 
+	log.Info("Database up to date.")
+
 	return nil
 }
 
@@ -183,7 +224,23 @@ func (lb *Command) ParseFlags(args []string) {
 	lb.flags = pflag.NewFlagSet(lb.Name(), pflag.ContinueOnError)
 	lb.flags.StringVarP(&lb.connectionName, "conn", "", "development", "the name of the connection to use")
 	lb.flags.IntVarP(&lb.steps, "steps", "s", 0, "number of migrations to run")
-	lb.flags.Parse(args) //nolint:errcheck,we don't care hence the flag
+	lb.flags.StringVar(&lb.contexts, "contexts", "", "comma separated contexts to run the changesets of")
+	lb.flags.StringVar(&lb.labels, "labels", "", "label expression to filter the changesets with")
+	lb.flags.DurationVar(&lb.lockWait, "lock-wait", defaultLockWait, "time to wait for the changelog lock")
+	lb.flags.BoolVarP(&lb.force, "force", "f", false, "release the changelog lock without asking for confirmation")
+	lb.flags.BoolVar(&lb.exitCode, "exit-code", false, "fail when status finds pending changesets")
+	lb.flags.BoolVar(&lb.dryRun, "dry-run", false, "write the SQL instead of running it")
+	lb.flags.StringVarP(&lb.outputFile, "output", "o", "", "file to write the SQL of dry runs to, defaults to stdout")
+	lb.flags.StringVar(&lb.toTag, "to-tag", "", "roll back the changesets executed after the tag")
+	lb.flags.StringVar(&lb.toDate, "to-date", "", "roll back the changesets executed after the RFC3339 time")
+	lb.flags.StringVar(&lb.changeSet, "changeset", "", "roll back only the file::id::author changeset")
+	lb.flags.BoolVar(&lb.lastDeployment, "last-deployment", false, "roll back the changesets of the last migration run")
+	lb.flags.StringVar(&lb.since, "since", "", "show the history since the date or RFC3339 time")
+	lb.flags.StringVar(&lb.file, "file", "", "show the history of the changesets in the file")
+	lb.flags.StringVar(&lb.author, "author", "", "show the history of the changesets by the author")
+	lb.flags.StringVar(&lb.tag, "tag", "", "show the deployments with the tag")
+	lb.flags.StringVar(&lb.format, "format", "table", "history format, table or json")
+	lb.flagsErr = lb.flags.Parse(args)
 }
 
 func (lb *Command) Flags() *pflag.FlagSet {
@@ -205,6 +262,120 @@ func (lb Command) ReadChangelog() (*ChangeLog, error) {
 	return cl, nil
 }
 
+// fileChangeSet is a changeset and the migration file it was read from,
+// file is the filename it's stored with in the databasechangelog table.
+type fileChangeSet struct {
+	ChangeSet
+	file string
+	path string
+
+	// filePreConditions are the preconditions of the migration file.
+	filePreConditions *PreConditions
+}
+
+// readChangeSets reads the changesets of every migration in the
+// changelog, in the order they should be executed.
+func (lb Command) readChangeSets(cl *ChangeLog) ([]fileChangeSet, error) {
+	var changeSets []fileChangeSet
+	for _, v := range cl.Migrations {
+		m, err := lb.ReadMigration(v.File)
+		if err != nil {
+			return nil, err
+		}
+
+		if m == nil {
+			log.Infof("[Warning] Skipping migration `%v` because its not processable by Liquo.", v.File)
+			continue
+		}
+
+		for _, cs := range m.ChangeSets {
+			cs.Context = andExpression(v.contexts(), cs.contexts())
+			cs.ContextFilter = ""
+			cs.Labels = strings.Join(append(splitList(v.Labels), splitList(cs.Labels)...), ",")
+
+			changeSets = append(changeSets, fileChangeSet{
+				ChangeSet:         cs,
+				file:              m.filename(cs, v.File),
+				path:              v.File,
+				filePreConditions: m.PreConditions,
+			})
+		}
+	}
+
+	return changeSets, resolveRollbacks(changeSets)
+}
+
+// fileAction returns what to do with the changeset according to the
+// preconditions of its migration file. These are verified once per run,
+// before any of its pending changesets are executed, actions keeps them.
+func (cs fileChangeSet) fileAction(ctx context.Context, conn *pgx.Conn, actions map[string]string) (string, error) {
+	if action, ok := actions[cs.path]; ok || cs.filePreConditions == nil {
+		return action, nil
+	}
+
+	action, err := cs.filePreConditions.verify(ctx, conn, fmt.Sprintf("migration `%v`", cs.path))
+	actions[cs.path] = action
+
+	return action, err
+}
+
+// key identifies the changeset like Liquibase does.
+func (cs fileChangeSet) key() string {
+	return changeSetKey(cs.file, cs.ID, cs.Author)
+}
+
+// changeSetKey joins the filename, id and author of a changeset
+// in the file::id::author format Liquibase uses to show them.
+func changeSetKey(file, id, author string) string {
+	return file + "::" + id + "::" + author
+}
+
+// included returns whether the changeset should run with the contexts
+// and labels passed. Like in Liquibase, everything runs when no contexts
+// or labels are passed, and changesets without them always run.
+func (lb Command) included(cs ChangeSet) (bool, error) {
+	if contexts := splitList(lb.contexts); len(contexts) > 0 && cs.contexts() != "" {
+		ok, err := matchExpression(cs.contexts(), contexts)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	if lb.labels != "" && cs.Labels != "" {
+		return matchExpression(lb.labels, splitList(cs.Labels))
+	}
+
+	return true, nil
+}
+
+// pending returns the changesets included in the run
+// that have to be executed according to the history.
+func (lb Command) pending(h *changeLogHistory, changeSets []fileChangeSet) ([]fileChangeSet, error) {
+	var pending []fileChangeSet
+	for _, cs := range changeSets {
+		included, err := lb.included(cs.ChangeSet)
+		if err != nil {
+			return nil, fmt.Errorf("changeset `%s`: %w", cs.ID, err)
+		}
+
+		if included && h.pending(cs.ChangeSet, cs.file) {
+			pending = append(pending, cs)
+		}
+	}
+
+	return pending, nil
+}
+
+// andExpression combines two context expressions
+// so both of them must match.
+func andExpression(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+
+	return "(" + a + ") and (" + b + ")"
+}
+
 func (lb Command) ReadMigration(path string) (*Migration, error) {
 	d, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -221,9 +392,65 @@ func (lb Command) ReadMigration(path string) (*Migration, error) {
 		return nil, err
 	}
 
+	m.resolve(path)
+
 	return m, nil
 }
 
+// connect to the database of the connection specified
+// with --conn and ensure the liquibase tables are there.
+func (lb Command) connect(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := lb.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lb.EnsureTables(conn)
+	if err != nil {
+		conn.Close(context.Background())
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// dial connects to the database of the connection specified with --conn.
+func (lb Command) dial(ctx context.Context) (*pgx.Conn, error) {
+	cx := lb.connections[lb.connectionName]
+	if cx == nil {
+		return nil, errors.New("connection not found")
+	}
+
+	return pgx.Connect(ctx, cx.URL())
+}
+
+// connectReadOnly connects without creating the liquibase tables, dry runs
+// use it. When the databasechangelog table is missing an empty temporary
+// one stands in for it, so the run reads an empty history.
+func (lb Command) connectReadOnly(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := lb.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = conn.QueryRow(ctx, `SELECT to_regclass('public.databasechangelog') IS NOT NULL`).Scan(&exists)
+	if err == nil && !exists {
+		// The first statement of the instruction creates the databasechangelog table.
+		stmt, _, _ := strings.Cut(createInstruction, ";")
+		_, err = conn.Exec(ctx, strings.Replace(stmt, "public.", "pg_temp.", 1))
+	}
+
+	if err != nil {
+		conn.Close(context.Background())
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
 // EnsureTables are in the database.
 func (lb Command) EnsureTables(conn *pgx.Conn) error {
 	err := conn.Ping(context.Background())
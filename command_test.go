@@ -1,9 +1,11 @@
 package liquo_test
 
 import (
+	"context"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/wawandco/liquo"
@@ -56,3 +58,51 @@ func TestReadMigration(t *testing.T) {
 	r.Contains(m.ChangeSets[0].SQL[0], `CREATE TABLE organizational_units (`)
 	r.Contains(m.ChangeSets[0].SQL[1], `SELECT 1`)
 }
+
+func TestParseFlags(t *testing.T) {
+	r := require.New(t)
+
+	c := &liquo.Command{}
+	c.ParseFlags([]string{"db", "migrate", "down", "--steps", "3", "--lock-wait", "30s"})
+
+	steps, err := c.Flags().GetInt("steps")
+	r.NoError(err)
+	r.Equal(3, steps)
+
+	wait, err := c.Flags().GetDuration("lock-wait")
+	r.NoError(err)
+	r.Equal(30*time.Second, wait)
+
+	c.ParseFlags([]string{"db", "migrate", "status", "--exit-code"})
+	exitCode, err := c.Flags().GetBool("exit-code")
+	r.NoError(err)
+	r.True(exitCode)
+
+	c.ParseFlags([]string{"db", "migrate", "down", "--last-deployment", "--dry-run"})
+	last, err := c.Flags().GetBool("last-deployment")
+	r.NoError(err)
+	r.True(last)
+}
+
+func TestRunPositionalArgs(t *testing.T) {
+	r := require.New(t)
+
+	c := &liquo.Command{}
+	c.ParseFlags([]string{"db", "migrate", "--conn", "missing", "tag"})
+	r.ErrorIs(c.Run(context.Background(), "", []string{"db", "migrate", "--conn", "missing", "tag"}), liquo.ErrNoTagName)
+
+	c.ParseFlags([]string{"db", "migrate", "tag", "--conn", "missing"})
+	r.ErrorIs(c.Run(context.Background(), "", []string{"db", "migrate", "tag", "--conn", "missing"}), liquo.ErrNoTagName, "flags are not tag names")
+}
+
+func TestRunFlagErrors(t *testing.T) {
+	r := require.New(t)
+
+	c := &liquo.Command{}
+	c.ParseFlags([]string{"db", "migrate", "--typo", "down"})
+	r.ErrorContains(c.Run(context.Background(), "", []string{"db", "migrate", "--typo", "down"}), "unknown flag: --typo")
+
+	c = &liquo.Command{}
+	c.ParseFlags([]string{"db", "migrate", "--help"})
+	r.NoError(c.Run(context.Background(), "", []string{"db", "migrate", "--help"}), "help doesn't run up")
+}
@@ -0,0 +1,96 @@
+package liquo
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// readCSV reads the records in r. Unlike encoding/csv it allows to set
+// the quote character as Liquibase does with the quotchar attribute.
+// Empty lines and lines starting with comment are skipped.
+func readCSV(r io.Reader, separator, quote rune, comment string) ([][]string, error) {
+	br := bufio.NewReader(r)
+
+	var records [][]string
+	var record []string
+	var field strings.Builder
+	var inQuotes, lineStart = false, true
+
+	endRecord := func() {
+		record = append(record, field.String())
+		field.Reset()
+
+		if len(record) > 1 || record[0] != "" {
+			records = append(records, record)
+		}
+
+		record = nil
+		lineStart = true
+	}
+
+	for {
+		c, _, err := br.ReadRune()
+		if errors.Is(err, io.EOF) {
+			if inQuotes {
+				return nil, errors.New("csv: unterminated quoted field")
+			}
+
+			if !lineStart {
+				endRecord()
+			}
+
+			return records, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if first, _ := utf8.DecodeRuneInString(comment); lineStart && comment != "" && !inQuotes && c == first {
+			rest, err := br.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+
+			if strings.HasPrefix(string(c)+rest, comment) {
+				continue
+			}
+
+			// Not a comment after all, put back what we read as
+			// part of the line.
+			br = bufio.NewReader(io.MultiReader(strings.NewReader(rest), br))
+		}
+
+		lineStart = false
+		switch {
+		case inQuotes && c == quote:
+			next, _, err := br.ReadRune()
+			if err == nil && next == quote {
+				field.WriteRune(quote)
+				continue
+			}
+
+			if err == nil {
+				br.UnreadRune() //nolint:errcheck,we just read it
+			}
+
+			inQuotes = false
+		case inQuotes:
+			field.WriteRune(c)
+		case c == quote && field.Len() == 0:
+			inQuotes = true
+		case c == separator:
+			record = append(record, field.String())
+			field.Reset()
+		case c == '\r':
+			// Line endings are handled on \n.
+		case c == '\n':
+			endRecord()
+		default:
+			field.WriteRune(c)
+		}
+	}
+}
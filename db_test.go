@@ -0,0 +1,81 @@
+package liquo
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// testConn connects to the database in LIQUO_TEST_DATABASE_URL with empty
+// liquibase tables, tests that need a database are skipped without it.
+func testConn(t *testing.T) *pgx.Conn {
+	t.Helper()
+
+	url := os.Getenv("LIQUO_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("LIQUO_TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(ctx) })
+
+	_, err = conn.Exec(ctx, `DROP TABLE IF EXISTS public.databasechangelog, public.databasechangeloglock`)
+	require.NoError(t, err)
+	require.NoError(t, Command{}.EnsureTables(conn))
+
+	return conn
+}
+
+// testCommand returns a command using the test database, run from a temp
+// dir with the migration files passed by path. Call it after testConn.
+func testCommand(t *testing.T, files map[string]string) *Command {
+	t.Helper()
+
+	cx, err := pop.NewConnection(&pop.ConnectionDetails{URL: os.Getenv("LIQUO_TEST_DATABASE_URL")})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return &Command{connectionName: "test", connections: map[string]*pop.Connection{"test": cx}}
+}
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+
+	fn()
+	w.Close()
+
+	return <-out
+}
@@ -0,0 +1,315 @@
+package liquo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// UpdateSQL writes the SQL script Up would run to stdout or the --output
+// file instead of running it, along with the changes to the liquibase
+// tables. Checksums and preconditions are checked against the database
+// like in Up, without changing it.
+func (lb Command) UpdateSQL(ctx context.Context) error {
+	// Messages go to stderr so the script in stdout is valid SQL.
+	defer log.SetOutput(os.Stderr)()
+
+	conn, err := lb.connectReadOnly(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	cl, err := lb.ReadChangelog()
+	if err != nil {
+		return err
+	}
+
+	changeSets, err := lb.readChangeSets(cl)
+	if err != nil {
+		return err
+	}
+
+	h, err := loadHistory(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	missing, err := checkChecksums(h, changeSets)
+	if err != nil {
+		return err
+	}
+
+	for _, cs := range missing {
+		h.ran[cs.key()] = cs.Checksum()
+	}
+
+	pending, err := lb.pending(h, changeSets)
+	if err != nil {
+		return err
+	}
+
+	changeLogAction, err := cl.PreConditions.verify(ctx, conn, "changelog")
+	if err != nil {
+		return err
+	}
+
+	w, err := lb.output()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	s := &sqlScript{w: w}
+	s.comment("Update SQL generated by liquo at %v", time.Now().Format(time.RFC3339))
+	s.comment("Liquibase tables")
+	s.write(Statement{SQL: createInstruction})
+	s.comment("Lock the changelog")
+	s.write(Statement{SQL: lockRowStmt}, Statement{SQL: lockStmt, Args: []any{time.Now(), lockedBy()}})
+
+	if len(missing) > 0 {
+		s.comment("Store the checksum of the changesets executed without one")
+		for _, cs := range missing {
+			s.write(cs.checksumStatement())
+		}
+	}
+
+	actions := map[string]string{}
+	for _, mc := range pending {
+		action := changeLogAction
+		if action == "" {
+			action, err = mc.fileAction(ctx, conn, actions)
+			if err != nil {
+				return err
+			}
+		}
+
+		if action == "" {
+			action, err = mc.PreConditions.verify(ctx, conn, fmt.Sprintf("changeset `%v`", mc.ID))
+			if err != nil {
+				return err
+			}
+		}
+
+		switch action {
+		case onFailContinue:
+			continue
+		case onFailMarkRan:
+			if executed, _ := h.executed(mc.ChangeSet, mc.file); executed {
+				continue
+			}
+
+			s.comment("Changeset %v marked as ran", mc.key())
+			s.write(mc.recordStatement(mc.file, "MARK_RAN", h))
+		default:
+			stmts, err := mc.statements()
+			if err != nil {
+				return fmt.Errorf("changeset `%s`: %w", mc.ID, err)
+			}
+
+			s.comment("Changeset %v", mc.key())
+			s.write(stmts...)
+			s.write(mc.recordStatement(mc.file, h.exectype(mc.ChangeSet, mc.file), h))
+		}
+
+		h.add(mc.ChangeSet, mc.file, h.order+1)
+	}
+
+	s.comment("Release the changelog lock")
+	s.write(Statement{SQL: unlockStmt, Args: []any{lockedBy()}})
+
+	if s.err == nil && lb.outputFile != "" {
+		log.Infof("SQL written to %v.", lb.outputFile)
+	}
+
+	return s.err
+}
+
+// output returns where dry runs write their SQL, the
+// --output file or stdout when it's not specified.
+func (lb Command) output() (io.WriteCloser, error) {
+	if lb.outputFile == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	return os.Create(lb.outputFile)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// sqlScript writes statements as a SQL script, it keeps
+// the first error so writes can be chained.
+type sqlScript struct {
+	w   io.Writer
+	err error
+}
+
+func (s *sqlScript) comment(format string, args ...any) {
+	if s.err == nil {
+		_, s.err = fmt.Fprintf(s.w, "\n-- "+format+"\n", args...)
+	}
+}
+
+func (s *sqlScript) write(stmts ...Statement) {
+	for _, stmt := range stmts {
+		if s.err == nil {
+			_, s.err = fmt.Fprintln(s.w, render(stmt))
+		}
+	}
+}
+
+// render returns the SQL of the statement with its args in
+// place of the placeholders, ending with a semicolon.
+func render(stmt Statement) string {
+	sql := strings.TrimSpace(stmt.SQL)
+	if len(stmt.Args) > 0 {
+		sql = substitute(sql, stmt.Args)
+	}
+
+	if !strings.HasSuffix(sql, ";") {
+		sql += ";"
+	}
+
+	return sql
+}
+
+// substitute replaces the $n placeholders in sql with the literals of the
+// args. Quoted strings and identifiers, dollar quoted strings and comments
+// are copied as they are, the $n in them are not placeholders.
+func substitute(sql string, args []any) string {
+	var b strings.Builder
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		end := i + 1
+		switch {
+		case c == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentChar(sql[i-2])):
+			end = closing(sql, i+1, "'", true)
+		case c == '\'' || c == '"':
+			end = closing(sql, i+1, string(c), false)
+		case strings.HasPrefix(sql[i:], "--"):
+			end = closing(sql, i, "\n", false)
+		case strings.HasPrefix(sql[i:], "/*"):
+			end = blockCommentEnd(sql, i)
+		case c == '$' && (i == 0 || !isIdentChar(sql[i-1])):
+			digits := i + 1
+			for digits < len(sql) && sql[digits] >= '0' && sql[digits] <= '9' {
+				digits++
+			}
+
+			if digits > i+1 {
+				n, _ := strconv.Atoi(sql[i+1 : digits])
+				if n >= 1 && n <= len(args) {
+					b.WriteString(literal(args[n-1]))
+					i = digits
+
+					continue
+				}
+
+				end = digits
+				break
+			}
+
+			if tag := dollarTag(sql[i:]); tag != "" {
+				end = closing(sql, i+len(tag), tag, false)
+			}
+		}
+
+		b.WriteString(sql[i:end])
+		i = end
+	}
+
+	return b.String()
+}
+
+// closing returns the index after the end of the text that starts at from
+// and ends with the delimiter, or the end of sql when it's not closed.
+// Backslashes escape the next character when escapes is set.
+func closing(sql string, from int, delimiter string, escapes bool) int {
+	for i := from; i < len(sql); i++ {
+		if escapes && sql[i] == '\\' {
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(sql[i:], delimiter) {
+			return i + len(delimiter)
+		}
+	}
+
+	return len(sql)
+}
+
+// blockCommentEnd returns the index after the block comment that
+// starts at from, these can be nested in PostgreSQL.
+func blockCommentEnd(sql string, from int) int {
+	depth := 0
+	for i := from; i < len(sql)-1; i++ {
+		switch sql[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(sql)
+}
+
+// dollarTag returns the $tag$ that starts a dollar quoted
+// string at the start of sql or "" when there is none.
+func dollarTag(sql string) string {
+	for i := 1; i < len(sql); i++ {
+		if sql[i] == '$' {
+			return sql[:i+1]
+		}
+
+		if !isIdentChar(sql[i]) || (i == 1 && sql[i] >= '0' && sql[i] <= '9') {
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// literal returns the SQL literal of a statement arg.
+func literal(arg any) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case *string:
+		if v == nil {
+			return "NULL"
+		}
+
+		return quote(*v)
+	case string:
+		return quote(v)
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return quote(v.Format("2006-01-02 15:04:05.999999"))
+	}
+
+	return quote(fmt.Sprint(arg))
+}
@@ -0,0 +1,137 @@
+package liquo
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal("SELECT 1;", render(Statement{SQL: "\n\tSELECT 1\n"}))
+	r.Equal("SELECT '$1';", render(Statement{SQL: "SELECT '$1';"}), "statements without args are left as they are")
+
+	name := "O'Brien"
+	stmt := Statement{
+		SQL:  "INSERT INTO users (a, b, c, d, e, f, g, h, i, j) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		Args: []any{name, &name, (*string)(nil), nil, true, 3, time.Date(2024, 5, 14, 10, 30, 0, 0, time.UTC), "4", "5", "ten"},
+	}
+
+	r.Equal("INSERT INTO users (a, b, c, d, e, f, g, h, i, j) VALUES ('O''Brien', 'O''Brien', NULL, NULL, TRUE, 3, '2024-05-14 10:30:00', '4', '5', 'ten');", render(stmt))
+
+	// Only the placeholders outside of quoted text and comments are replaced.
+	for sql, expected := range map[string]string{
+		"UPDATE items SET note = 'cost $1', price = $1":           "UPDATE items SET note = 'cost $1', price = 9;",
+		"UPDATE items SET note = 'it''s $1', price = $1":          "UPDATE items SET note = 'it''s $1', price = 9;",
+		`UPDATE items SET note = E'it\'s $1', price = $1`:         `UPDATE items SET note = E'it\'s $1', price = 9;`,
+		`UPDATE "items $1" SET price = $1`:                        `UPDATE "items $1" SET price = 9;`,
+		"UPDATE items SET price = $1 -- was $1\nWHERE id = $1":    "UPDATE items SET price = 9 -- was $1\nWHERE id = 9;",
+		"UPDATE items /* $1 /* nested $1 */ $1 */ SET price = $1": "UPDATE items /* $1 /* nested $1 */ $1 */ SET price = 9;",
+		"SELECT $fn$ RETURN $1; $fn$, $$ $1 $$, $1":               "SELECT $fn$ RETURN $1; $fn$, $$ $1 $$, 9;",
+		"SELECT price$1, $2 FROM items":                           "SELECT price$1, $2 FROM items;",
+		"SELECT 'unterminated $1":                                 "SELECT 'unterminated $1;",
+	} {
+		r.Equal(expected, render(Statement{SQL: sql, Args: []any{9}}), sql)
+	}
+}
+
+func TestSQLScript(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(`<changeSet id="1" author="ox">
+		<insert tableName="users"><column name="name" value="ox"/></insert>
+	</changeSet>`), &cs))
+
+	stmts, err := cs.statements()
+	r.NoError(err)
+
+	h := &changeLogHistory{ran: map[string]string{}, order: 7, deploymentID: "1234567890"}
+
+	var out bytes.Buffer
+	s := &sqlScript{w: &out}
+	s.comment("Changeset %v", changeSetKey("a.xml", cs.ID, cs.Author))
+	s.write(stmts...)
+	s.write(cs.recordStatement("a.xml", h.exectype(cs, "a.xml"), h))
+	r.NoError(s.err)
+
+	r.Contains(out.String(), "\n-- Changeset a.xml::1::ox\nINSERT INTO users (name) VALUES ('ox');\n")
+	r.Contains(out.String(), "INTO databasechangelog")
+	r.Contains(out.String(), "'a.xml'")
+	r.Contains(out.String(), ", 8, 'EXECUTED', ")
+	r.Contains(out.String(), "'liquo', '1234567890', NULL);")
+}
+
+func TestUpdateSQLStdout(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	lb := testCommand(t, map[string]string{
+		"migrations/changelog.xml": `<databaseChangeLog>
+			<include file="migrations/notes.sql"/>
+			<include file="migrations/users.xml"/>
+		</databaseChangeLog>`,
+		"migrations/notes.sql": `SELECT 1;`,
+		"migrations/users.xml": `<databaseChangeLog>
+			<changeSet id="1" author="ox">
+				<preConditions onFail="CONTINUE"><tableExists tableName="missing_table"/></preConditions>
+				<sql>SELECT 1;</sql>
+			</changeSet>
+			<changeSet id="2" author="ox">
+				<createTable tableName="update_sql_users"><column name="name" type="text"/></createTable>
+			</changeSet>
+		</databaseChangeLog>`,
+	})
+
+	script := captureStdout(t, func() {
+		r.NoError(lb.UpdateSQL(ctx))
+	})
+
+	r.NotContains(script, "[info]")
+	r.NotContains(script, "[warning]")
+	r.Contains(script, "CREATE TABLE update_sql_users")
+
+	tx, err := conn.Begin(ctx)
+	r.NoError(err)
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, script)
+	r.NoError(err, "the script in stdout is valid SQL")
+}
+
+func TestDryRunWithoutTables(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, `DROP TABLE public.databasechangelog, public.databasechangeloglock`)
+	r.NoError(err)
+
+	lb := testCommand(t, map[string]string{
+		"migrations/changelog.xml": `<databaseChangeLog><include file="migrations/users.xml"/></databaseChangeLog>`,
+		"migrations/users.xml": `<databaseChangeLog>
+			<changeSet id="1" author="ox">
+				<preConditions onFail="MARK_RAN"><not><changeSetExecuted id="0" author="ox"/></not></preConditions>
+				<createTable tableName="dry_run_users"><column name="name" type="text"/></createTable>
+			</changeSet>
+		</databaseChangeLog>`,
+	})
+
+	update := captureStdout(t, func() {
+		r.NoError(lb.UpdateSQL(ctx))
+	})
+	r.Contains(update, "CREATE TABLE dry_run_users")
+
+	captureStdout(t, func() {
+		r.NoError(lb.RollbackSQL(ctx))
+	})
+
+	var exists bool
+	r.NoError(conn.QueryRow(ctx, `SELECT to_regclass('public.databasechangelog') IS NOT NULL OR to_regclass('public.databasechangeloglock') IS NOT NULL`).Scan(&exists))
+	r.False(exists, "dry runs don't create the liquibase tables")
+}
@@ -0,0 +1,162 @@
+package liquo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// matchExpression evaluates a Liquibase context or label expression like
+// "dev and !ci", "a or b" or "(a, b) and !c" against the passed values.
+// Commas work as or, names are compared without case.
+func matchExpression(expr string, values []string) (bool, error) {
+	set := map[string]bool{}
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+
+	p := &expressionParser{tokens: tokenize(expr), values: set}
+	ok, err := p.or()
+	if err != nil {
+		return false, fmt.Errorf("invalid expression %q: %w", expr, err)
+	}
+
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf("invalid expression %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+
+	return ok, nil
+}
+
+// splitList splits a comma separated list
+// leaving out the empty values.
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+func tokenize(expr string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, c := range expr {
+		switch c {
+		case '(', ')', '!', ',':
+			flush()
+			tokens = append(tokens, string(c))
+		case ' ', '\t', '\n', '\r':
+			flush()
+		default:
+			word.WriteRune(c)
+		}
+	}
+
+	flush()
+
+	return tokens
+}
+
+// expressionParser is a recursive descent parser for context and label
+// expressions, from lower to higher precedence: or (and commas), and, not.
+type expressionParser struct {
+	tokens []string
+	pos    int
+	values map[string]bool
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return strings.ToLower(p.tokens[p.pos])
+}
+
+func (p *expressionParser) or() (bool, error) {
+	result, err := p.and()
+	if err != nil {
+		return false, err
+	}
+
+	for p.peek() == "or" || p.peek() == "," {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return false, err
+		}
+
+		result = result || right
+	}
+
+	return result, nil
+}
+
+func (p *expressionParser) and() (bool, error) {
+	result, err := p.not()
+	if err != nil {
+		return false, err
+	}
+
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return false, err
+		}
+
+		result = result && right
+	}
+
+	return result, nil
+}
+
+func (p *expressionParser) not() (bool, error) {
+	if p.peek() == "!" || p.peek() == "not" {
+		p.pos++
+		result, err := p.not()
+
+		return !result, err
+	}
+
+	return p.operand()
+}
+
+func (p *expressionParser) operand() (bool, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return false, errors.New("unexpected end")
+	case ")", ",", "and", "or":
+		return false, fmt.Errorf("unexpected %q", token)
+	case "(":
+		p.pos++
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+
+		if p.peek() != ")" {
+			return false, errors.New("missing )")
+		}
+
+		p.pos++
+
+		return result, nil
+	}
+
+	p.pos++
+
+	return p.values[token], nil
+}
@@ -0,0 +1,78 @@
+package liquo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchExpression(t *testing.T) {
+	tcases := []struct {
+		expr   string
+		values []string
+		match  bool
+	}{
+		{"dev", []string{"dev"}, true},
+		{"dev", []string{"prod"}, false},
+		{"DEV", []string{"dev"}, true},
+		{"!test", []string{"dev"}, true},
+		{"!test", []string{"test"}, false},
+		{"dev and !ci", []string{"dev"}, true},
+		{"dev and !ci", []string{"dev", "ci"}, false},
+		{"a or b", []string{"b"}, true},
+		{"a, b", []string{"c"}, false},
+		{"a or b and c", []string{"a"}, true},
+		{"(a or b) and c", []string{"a"}, false},
+		{"(a or b) and c", []string{"b", "c"}, true},
+		{"not (a and b)", []string{"a"}, true},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.expr, func(t *testing.T) {
+			r := require.New(t)
+			match, err := matchExpression(tc.expr, tc.values)
+			r.NoError(err)
+			r.Equal(tc.match, match)
+		})
+	}
+
+	for _, expr := range []string{"", "a and", "(a or b", "a b", "and a"} {
+		_, err := matchExpression(expr, nil)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestIncluded(t *testing.T) {
+	r := require.New(t)
+	dev := ChangeSet{Context: "dev", Labels: "seed, demo"}
+	plain := ChangeSet{}
+
+	for _, cs := range []ChangeSet{dev, plain} {
+		ok, err := Command{}.included(cs)
+		r.NoError(err)
+		r.True(ok, "everything runs without contexts or labels")
+	}
+
+	ok, err := Command{contexts: "staging"}.included(dev)
+	r.NoError(err)
+	r.False(ok)
+
+	ok, err = Command{contexts: "staging"}.included(plain)
+	r.NoError(err)
+	r.True(ok)
+
+	ok, err = Command{contexts: "staging, dev"}.included(dev)
+	r.NoError(err)
+	r.True(ok)
+
+	ok, err = Command{labels: "!demo"}.included(dev)
+	r.NoError(err)
+	r.False(ok)
+
+	ok, err = Command{labels: "seed and !other"}.included(dev)
+	r.NoError(err)
+	r.True(ok)
+
+	r.Equal("(a) and (!b)", andExpression("a", "!b"))
+	r.Equal("a", andExpression("a", ""))
+}
@@ -0,0 +1,273 @@
+package liquo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// writtenBy is stored in the liquibase column of the databasechangelog
+// table, where Liquibase stores its version, so rows written by liquo
+// are not taken for rows written by Liquibase.
+const writtenBy = "liquo"
+
+// changeLogHistory is the databasechangelog table loaded in memory so
+// a run queries it once instead of once per changeset. It maps the
+// changesets executed to their checksum, order is the last orderexecuted
+// and deploymentID identifies the rows written by the run.
+type changeLogHistory struct {
+	ran          map[string]string
+	order        int
+	deploymentID string
+
+	// failed are the changesets recorded as FAILED, like in Liquibase
+	// these didn't run and are pending until they succeed.
+	failed map[string]bool
+}
+
+// loadHistory reads the databasechangelog table.
+func loadHistory(ctx context.Context, conn *pgx.Conn) (*changeLogHistory, error) {
+	return queryHistory(ctx, conn, `TRUE`)
+}
+
+// loadChangeSetHistory reads the row of a single changeset and the last
+// orderexecuted, so running one changeset doesn't read the whole table.
+func loadChangeSetHistory(ctx context.Context, conn *pgx.Conn, cs ChangeSet, file string) (*changeLogHistory, error) {
+	h, err := queryHistory(ctx, conn, `id = $1 AND author = $2 AND filename = $3`, cs.ID, cs.Author, file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.QueryRow(ctx, `SELECT COALESCE(max(orderexecuted), 0) FROM databasechangelog`).Scan(&h.order)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the executed changesets:%w", err)
+	}
+
+	return h, nil
+}
+
+// queryHistory reads the rows of the databasechangelog table matching where.
+func queryHistory(ctx context.Context, conn *pgx.Conn, where string, args ...any) (*changeLogHistory, error) {
+	rows, err := conn.Query(ctx, `SELECT filename, id, author, COALESCE(md5sum, ''), orderexecuted, exectype FROM databasechangelog WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the executed changesets:%w", err)
+	}
+	defer rows.Close()
+
+	h := &changeLogHistory{ran: map[string]string{}, failed: map[string]bool{}, deploymentID: deploymentID()}
+	for rows.Next() {
+		var file, id, author, md5sum, exectype string
+		var order int
+		if err := rows.Scan(&file, &id, &author, &md5sum, &order, &exectype); err != nil {
+			return nil, err
+		}
+
+		h.order = max(h.order, order)
+		if exectype == "FAILED" {
+			h.failed[changeSetKey(file, id, author)] = true
+			continue
+		}
+
+		h.ran[changeSetKey(file, id, author)] = md5sum
+	}
+
+	return h, rows.Err()
+}
+
+// executed returns whether the changeset is in the databasechangelog table
+// and the checksum stored for it. Like in Liquibase changesets are
+// identified by their id, author and filename.
+func (h *changeLogHistory) executed(cs ChangeSet, file string) (bool, string) {
+	md5sum, ok := h.ran[changeSetKey(file, cs.ID, cs.Author)]
+
+	return ok, md5sum
+}
+
+// pending returns whether the changeset has to run, executed changesets only
+// run again when they are runAlways or runOnChange and they changed.
+func (h *changeLogHistory) pending(cs ChangeSet, file string) bool {
+	executed, md5sum := h.executed(cs, file)
+	if !executed {
+		return true
+	}
+
+	return cs.RunAlways || (cs.RunOnChange && md5sum != cs.Checksum())
+}
+
+// exectype returns how a pending changeset is recorded when it runs.
+func (h *changeLogHistory) exectype(cs ChangeSet, file string) string {
+	if executed, _ := h.executed(cs, file); executed {
+		return "RERAN"
+	}
+
+	return "EXECUTED"
+}
+
+// add keeps track of a changeset stored in the databasechangelog
+// table during the run and the order it was given.
+func (h *changeLogHistory) add(cs ChangeSet, file string, order int) {
+	h.ran[changeSetKey(file, cs.ID, cs.Author)] = cs.Checksum()
+	h.order = max(h.order, order)
+}
+
+// fail keeps track of a changeset recorded as FAILED during the run,
+// it's not added to the executed ones.
+func (h *changeLogHistory) fail(cs ChangeSet, file string, order int) {
+	h.failed[changeSetKey(file, cs.ID, cs.Author)] = true
+	h.order = max(h.order, order)
+}
+
+// recorded returns whether the changeset has a row in the
+// databasechangelog table, including the FAILED ones.
+func (h *changeLogHistory) recorded(cs ChangeSet, file string) bool {
+	executed, _ := h.executed(cs, file)
+
+	return executed || h.failed[changeSetKey(file, cs.ID, cs.Author)]
+}
+
+// deploymentID generates the id of a run the way Liquibase
+// does, with the last 10 digits of the current time in ms.
+func deploymentID() string {
+	return fmt.Sprintf("%010d", time.Now().UnixMilli()%10_000_000_000)
+}
+
+// ranChangeSet is a row of the databasechangelog table.
+type ranChangeSet struct {
+	ID            string    `json:"id"`
+	Author        string    `json:"author"`
+	Filename      string    `json:"filename"`
+	DateExecuted  time.Time `json:"dateexecuted"`
+	OrderExecuted int       `json:"orderexecuted"`
+	ExecType      string    `json:"exectype"`
+	MD5Sum        string    `json:"md5sum,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	Comments      string    `json:"comments,omitempty"`
+	Tag           string    `json:"tag,omitempty"`
+}
+
+// deployment is the changesets executed by the same run.
+type deployment struct {
+	ID         string         `json:"deployment_id"`
+	ChangeSets []ranChangeSet `json:"changesets"`
+}
+
+// History prints the executed changesets grouped by deployment, filtered
+// with --since, --file, --author and --tag. Filtering by tag shows the
+// deployments the tag is in.
+func (lb Command) History(ctx context.Context) error {
+	var since time.Time
+	if lb.since != "" {
+		var err error
+		since, err = parseTime(lb.since)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+
+	if lb.format != "table" && lb.format != "json" {
+		return fmt.Errorf("invalid --format %q, use table or json", lb.format)
+	}
+
+	conn, err := lb.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	rows, err := conn.Query(ctx, `
+		SELECT id, author, filename, dateexecuted, orderexecuted, exectype, COALESCE(md5sum, ''),
+			COALESCE(description, ''), COALESCE(comments, ''), COALESCE(tag, ''), COALESCE(deployment_id, '')
+		FROM databasechangelog
+		WHERE dateexecuted >= $1
+			AND ($2 = '' OR filename = $2)
+			AND ($3 = '' OR author = $3)
+			AND ($4 = '' OR deployment_id IN (SELECT deployment_id FROM databasechangelog WHERE tag = $4))
+		ORDER BY orderexecuted`,
+		since, lb.file, lb.author, lb.tag,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var deployments []deployment
+	for rows.Next() {
+		var rc ranChangeSet
+		var id string
+		err := rows.Scan(&rc.ID, &rc.Author, &rc.Filename, &rc.DateExecuted, &rc.OrderExecuted, &rc.ExecType, &rc.MD5Sum, &rc.Description, &rc.Comments, &rc.Tag, &id)
+		if err != nil {
+			return err
+		}
+
+		// Rows are grouped while they are consecutive, rows written
+		// before deployment ids were recorded don't have one.
+		if len(deployments) == 0 || deployments[len(deployments)-1].ID != id {
+			deployments = append(deployments, deployment{ID: id})
+		}
+
+		last := &deployments[len(deployments)-1]
+		last.ChangeSets = append(last.ChangeSets, rc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return writeHistory(os.Stdout, deployments, lb.format)
+}
+
+// writeHistory renders the deployments as a table or as json.
+func writeHistory(w io.Writer, deployments []deployment, format string) error {
+	if format == "json" {
+		if deployments == nil {
+			deployments = []deployment{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(deployments)
+	}
+
+	if len(deployments) == 0 {
+		_, err := fmt.Fprintln(w, "No changesets executed.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, d := range deployments {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+
+		id := d.ID
+		if id == "" {
+			id = "unknown"
+		}
+
+		fmt.Fprintf(tw, "Deployment %v\n", id)
+		fmt.Fprintln(tw, "EXECUTED\tTYPE\tCHANGESET\tTAG\tCHECKSUM")
+		for _, rc := range d.ChangeSets {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", rc.DateExecuted.Format(time.DateTime), rc.ExecType, changeSetKey(rc.Filename, rc.ID, rc.Author), rc.Tag, rc.MD5Sum)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// parseTime parses RFC3339 times and plain dates in the local time
+// zone, dateexecuted is stored in local time without a zone.
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t.Local(), nil
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
@@ -0,0 +1,158 @@
+package liquo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryPending(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{ID: "1", Author: "ox", Changes: []Change{&RawSQL{SQL: "SELECT 1;"}}}
+
+	h := &changeLogHistory{ran: map[string]string{}}
+	r.True(h.pending(cs, "a.xml"))
+
+	h.add(cs, "a.xml", 4)
+	r.Equal(4, h.order)
+	r.False(h.pending(cs, "a.xml"))
+	r.True(h.pending(cs, "b.xml"), "changesets in other files are different changesets")
+
+	changed := cs
+	changed.Changes = []Change{&RawSQL{SQL: "SELECT 2;"}}
+	r.False(h.pending(changed, "a.xml"))
+
+	changed.RunOnChange = true
+	r.True(h.pending(changed, "a.xml"))
+
+	cs.RunAlways = true
+	r.True(h.pending(cs, "a.xml"))
+}
+
+func TestHistoryFailed(t *testing.T) {
+	r := require.New(t)
+	cs := ChangeSet{ID: "1", Author: "ox", Changes: []Change{&RawSQL{SQL: "SELECT 1;"}}}
+
+	h := &changeLogHistory{ran: map[string]string{}, failed: map[string]bool{}, order: 2}
+	r.False(h.recorded(cs, "a.xml"))
+	r.Contains(cs.recordStatement("a.xml", "FAILED", h).SQL, "INSERT")
+
+	h.fail(cs, "a.xml", 3)
+	r.Equal(3, h.order)
+	r.True(h.pending(cs, "a.xml"), "failed changesets run again")
+	r.Equal("EXECUTED", h.exectype(cs, "a.xml"))
+	r.True(h.recorded(cs, "a.xml"))
+	r.Contains(cs.recordStatement("a.xml", "EXECUTED", h).SQL, "UPDATE databasechangelog", "the FAILED row is updated")
+}
+
+func TestLoadChangeSetHistory(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	h := &changeLogHistory{ran: map[string]string{}, failed: map[string]bool{}}
+	for i, id := range []string{"1", "2", "3"} {
+		cs := ChangeSet{ID: id, Author: "ox"}
+		stmt := cs.recordStatement("a.xml", "EXECUTED", h)
+		_, err := conn.Exec(ctx, stmt.SQL, stmt.Args...)
+		r.NoError(err)
+
+		h.add(cs, "a.xml", i+1)
+	}
+
+	cs := ChangeSet{ID: "2", Author: "ox"}
+	loaded, err := loadChangeSetHistory(ctx, conn, cs, "a.xml")
+	r.NoError(err)
+	r.Equal(map[string]string{"a.xml::2::ox": cs.Checksum()}, loaded.ran, "only the row of the changeset is read")
+	r.Equal(3, loaded.order, "the order is the last one of the table")
+	r.False(loaded.pending(cs, "a.xml"))
+
+	loaded, err = loadChangeSetHistory(ctx, conn, ChangeSet{ID: "4", Author: "ox"}, "a.xml")
+	r.NoError(err)
+	r.Empty(loaded.ran)
+	r.Equal(3, loaded.order)
+}
+
+func TestWriteHistory(t *testing.T) {
+	r := require.New(t)
+	executed := time.Date(2024, 5, 14, 10, 30, 0, 0, time.UTC)
+	deployments := []deployment{
+		{ID: "", ChangeSets: []ranChangeSet{{ID: "1", Author: "ox", Filename: "a.xml", DateExecuted: executed, ExecType: "EXECUTED"}}},
+		{ID: "5678901234", ChangeSets: []ranChangeSet{{ID: "2", Author: "ox", Filename: "a.xml", DateExecuted: executed, ExecType: "EXECUTED", Tag: "v1", MD5Sum: "9:abc"}}},
+	}
+
+	var out bytes.Buffer
+	r.NoError(writeHistory(&out, deployments, "table"))
+	r.Contains(out.String(), "Deployment unknown\n")
+	r.Contains(out.String(), "Deployment 5678901234\n")
+	r.Regexp(`2024-05-14 10:30:00 +EXECUTED +a.xml::2::ox +v1 +9:abc`, out.String())
+
+	out.Reset()
+	r.NoError(writeHistory(&out, deployments, "json"))
+
+	var decoded []deployment
+	r.NoError(json.Unmarshal(out.Bytes(), &decoded))
+	r.Equal(deployments, decoded)
+
+	out.Reset()
+	r.NoError(writeHistory(&out, nil, "json"))
+	r.Equal("[]\n", out.String())
+}
+
+func TestParseTime(t *testing.T) {
+	r := require.New(t)
+
+	day, err := parseTime("2024-05-14")
+	r.NoError(err)
+	r.Equal(time.Date(2024, 5, 14, 0, 0, 0, 0, time.Local), day)
+
+	_, err = parseTime("2024-05-14T10:30:00-05:00")
+	r.NoError(err)
+
+	_, err = parseTime("last tuesday")
+	r.Error(err)
+}
+
+// BenchmarkPending computes the pending changesets of a
+// changelog with a few thousand changesets already executed.
+func BenchmarkPending(b *testing.B) {
+	const size = 3000
+
+	var data strings.Builder
+	data.WriteString("<databaseChangeLog>")
+	for i := 0; i < size; i++ {
+		fmt.Fprintf(&data, `<changeSet id="%d" author="ox"><createTable tableName="t%d"><column name="id" type="int"/></createTable></changeSet>`, i, i)
+	}
+	data.WriteString("</databaseChangeLog>")
+
+	m := Migration{}
+	if err := xml.Unmarshal([]byte(data.String()), &m); err != nil {
+		b.Fatal(err)
+	}
+
+	h := &changeLogHistory{ran: map[string]string{}}
+	changeSets := make([]fileChangeSet, 0, size)
+	for i, cs := range m.ChangeSets {
+		changeSets = append(changeSets, fileChangeSet{ChangeSet: cs, file: "migrations/all.xml"})
+
+		// The last 10 changesets are pending.
+		if i < size-10 {
+			h.add(cs, "migrations/all.xml", i+1)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pending, err := Command{}.pending(h, changeSets)
+		if err != nil || len(pending) != 10 {
+			b.Fatalf("expected 10 pending changesets, got %v (%v)", len(pending), err)
+		}
+	}
+}
@@ -4,32 +4,48 @@ package log
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
+// output is where the messages are written, stdout unless
+// it's changed with SetOutput.
+var output io.Writer = os.Stdout
+
+// SetOutput changes where the messages are written, dry runs write them
+// to stderr to keep stdout for the SQL. It returns a func that restores
+// the previous output.
+func SetOutput(w io.Writer) func() {
+	previous := output
+	output = w
+
+	return func() { output = previous }
+}
+
 func Info(message string) {
-	fmt.Printf("[info] %v\n", message)
+	fmt.Fprintf(output, "[info] %v\n", message)
 }
 
 func Infof(message string, args ...any) {
-	fmt.Printf("[info] "+message+"\n", args...)
+	fmt.Fprintf(output, "[info] "+message+"\n", args...)
 }
 
 func Error(message string) {
-	fmt.Printf("[error] %v\n", message)
+	fmt.Fprintf(output, "[error] %v\n", message)
 }
 
 func Errorf(message string, args ...any) {
-	fmt.Printf("[error] "+message, args...)
+	fmt.Fprintf(output, "[error] "+message, args...)
 }
 
 func Debug(message string) {
-	fmt.Printf("[debug] %v\n", message)
+	fmt.Fprintf(output, "[debug] %v\n", message)
 }
 
 func Warn(message string) {
-	fmt.Printf("[warning] %v\n", message)
+	fmt.Fprintf(output, "[warning] %v\n", message)
 }
 
 func Warnf(message string, args ...any) {
-	fmt.Printf("[warning] "+message, args...)
+	fmt.Fprintf(output, "[warning] "+message, args...)
 }
@@ -0,0 +1,260 @@
+package liquo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// ErrLocked is returned when the changelog lock could not be
+// acquired within the lock wait time.
+var ErrLocked = errors.New("could not acquire the changelog lock")
+
+// defaultLockWait is how long to wait for the lock when
+// no --lock-wait is specified, same as Liquibase.
+const defaultLockWait = 5 * time.Minute
+
+// lockPollInterval is how often the lock is checked
+// while waiting for it to be released.
+const lockPollInterval = time.Second
+
+// lockKey is the advisory lock used to create the lock
+// row only once when instances start at the same time.
+const lockKey = 61539
+
+// lockRowStmt creates the databasechangeloglock row if it's not there yet,
+// lockStmt and unlockStmt take and free it, unlockStmt only frees it when
+// it's held by $1. forceUnlockStmt frees it no matter who holds it.
+const (
+	lockRowStmt     = `INSERT INTO databasechangeloglock (id, locked) SELECT 1, FALSE WHERE NOT EXISTS (SELECT 1 FROM databasechangeloglock WHERE id = 1)`
+	lockStmt        = `UPDATE databasechangeloglock SET locked = TRUE, lockgranted = $1, lockedby = $2 WHERE id = 1 AND locked = FALSE`
+	unlockStmt      = `UPDATE databasechangeloglock SET locked = FALSE, lockgranted = NULL, lockedby = NULL WHERE id = 1 AND lockedby = $1`
+	forceUnlockStmt = `UPDATE databasechangeloglock SET locked = FALSE, lockgranted = NULL, lockedby = NULL WHERE id = 1`
+)
+
+// acquireLock takes the databasechangeloglock row, waiting up to the
+// lock wait time for other instances to release it.
+func (lb Command) acquireLock(ctx context.Context, conn *pgx.Conn) error {
+	err := ensureLockRow(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	wait := lb.lockWait
+	if wait == 0 {
+		wait = defaultLockWait
+	}
+
+	deadline := time.Now().Add(wait)
+	for attempt := 0; ; attempt++ {
+		tag, err := conn.Exec(ctx, lockStmt, time.Now(), lockedBy())
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() > 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			_, by, granted, err := currentLock(ctx, conn)
+			if err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%w, locked by %v since %v", ErrLocked, by, granted.Format(time.RFC3339))
+		}
+
+		if attempt == 0 {
+			log.Info("Waiting for the changelog lock.")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// releaseLock frees the databasechangeloglock row when this instance
+// holds it, a lock released by someone else is left as it is.
+func (lb Command) releaseLock(conn *pgx.Conn) error {
+	released, err := unlock(conn, Statement{SQL: unlockStmt, Args: []any{lockedBy()}})
+	if err != nil {
+		return fmt.Errorf("could not release the changelog lock: %w", err)
+	}
+
+	if !released {
+		log.Warnf("The changelog lock was released by someone else while %v held it.\n", lockedBy())
+	}
+
+	return nil
+}
+
+// deferReleaseLock releases the lock when deferred, the error releasing it
+// is set in err unless the function already failed, then it's logged.
+func (lb Command) deferReleaseLock(conn *pgx.Conn, err *error) {
+	rerr := lb.releaseLock(conn)
+	if rerr == nil {
+		return
+	}
+
+	if *err == nil {
+		*err = rerr
+		return
+	}
+
+	log.Errorf("%v\n", rerr)
+}
+
+// unlock runs the statement that frees the lock row and returns whether it
+// did. Cancelled queries close the connection so a new one is opened to
+// release the lock in that case.
+func unlock(conn *pgx.Conn, stmt Statement) (bool, error) {
+	ctx := context.Background()
+	if conn.IsClosed() {
+		c, err := pgx.ConnectConfig(ctx, conn.Config())
+		if err != nil {
+			return false, err
+		}
+		defer c.Close(ctx)
+
+		conn = c
+	}
+
+	tag, err := conn.Exec(ctx, stmt.SQL, stmt.Args...)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListLocks prints who holds the changelog lock and since when.
+func (lb Command) ListLocks(ctx context.Context) error {
+	conn, err := lb.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	status, err := lockStatus(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	log.Info(status)
+
+	return nil
+}
+
+// lockStatus describes who holds the changelog lock and since when.
+func lockStatus(ctx context.Context, conn *pgx.Conn) (string, error) {
+	locked, by, granted, err := currentLock(ctx, conn)
+	if err != nil || !locked {
+		return "The changelog is not locked.", err
+	}
+
+	return fmt.Sprintf("The changelog is locked by %v since %v.", by, granted.Format(time.RFC3339)), nil
+}
+
+// ReleaseLocks forcibly releases the changelog lock, it asks for
+// confirmation unless --force is passed. This is meant to recover
+// from migrations that were killed while holding the lock.
+func (lb Command) ReleaseLocks(ctx context.Context) error {
+	conn, err := lb.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	status, err := lb.releaseLocks(ctx, conn, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	log.Info(status)
+
+	return nil
+}
+
+// releaseLocks releases the changelog lock no matter who holds it once the
+// answer read from in confirms it, the question is written to out. It
+// returns what was done.
+func (lb Command) releaseLocks(ctx context.Context, conn *pgx.Conn, in io.Reader, out io.Writer) (string, error) {
+	locked, by, granted, err := currentLock(ctx, conn)
+	if err != nil || !locked {
+		return "The changelog is not locked.", err
+	}
+
+	if !lb.force {
+		fmt.Fprintf(out, "The changelog is locked by %v since %v, release it? [y/N] ", by, granted.Format(time.RFC3339))
+
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return "The changelog lock was not released.", nil
+		}
+	}
+
+	if _, err := unlock(conn, Statement{SQL: forceUnlockStmt}); err != nil {
+		return "", fmt.Errorf("could not release the changelog lock: %w", err)
+	}
+
+	return "The changelog lock was released.", nil
+}
+
+// currentLock returns whether the changelog is locked,
+// who holds the lock and since when.
+func currentLock(ctx context.Context, conn *pgx.Conn) (bool, string, time.Time, error) {
+	var locked bool
+	var by string
+	var granted time.Time
+
+	row := conn.QueryRow(ctx, `SELECT locked, COALESCE(lockedby, ''), COALESCE(lockgranted, now()) FROM databasechangeloglock WHERE id = 1`)
+	err := row.Scan(&locked, &by, &granted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, "", granted, nil
+	}
+
+	return locked, by, granted, err
+}
+
+// ensureLockRow creates the lock row if it's not there yet.
+func ensureLockRow(ctx context.Context, conn *pgx.Conn) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck,rollback after commit is a no-op
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, lockKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, lockRowStmt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockedBy identifies this process in the lock row.
+func lockedBy() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%v (%d)", host, os.Getpid())
+}
@@ -0,0 +1,127 @@
+package liquo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+	lb := Command{lockWait: time.Millisecond}
+
+	r.NoError(lb.acquireLock(ctx, conn))
+
+	locked, by, _, err := currentLock(ctx, conn)
+	r.NoError(err)
+	r.True(locked)
+	r.Equal(lockedBy(), by)
+
+	// The lock is not granted twice, waiting for it times out.
+	start := time.Now()
+	err = lb.acquireLock(ctx, conn)
+	r.ErrorIs(err, ErrLocked)
+	r.ErrorContains(err, "locked by "+lockedBy())
+	r.Less(time.Since(start), 3*lockPollInterval)
+
+	r.NoError(lb.releaseLock(conn))
+	locked, _, _, err = currentLock(ctx, conn)
+	r.NoError(err)
+	r.False(locked)
+
+	r.NoError(lb.acquireLock(ctx, conn), "the lock can be taken again once released")
+}
+
+func TestReleaseLockOwner(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	r.NoError(ensureLockRow(ctx, conn))
+	_, err := conn.Exec(ctx, lockStmt, time.Now(), "other-host (1)")
+	r.NoError(err)
+
+	// The lock of another instance is left as it is.
+	r.NoError(Command{}.releaseLock(conn))
+	locked, by, _, err := currentLock(ctx, conn)
+	r.NoError(err)
+	r.True(locked)
+	r.Equal("other-host (1)", by)
+
+	released, err := unlock(conn, Statement{SQL: forceUnlockStmt})
+	r.NoError(err)
+	r.True(released)
+}
+
+func TestListLocks(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	status, err := lockStatus(ctx, conn)
+	r.NoError(err)
+	r.Equal("The changelog is not locked.", status, "there is no lock row yet")
+
+	r.NoError(Command{}.acquireLock(ctx, conn))
+
+	status, err = lockStatus(ctx, conn)
+	r.NoError(err)
+	r.Contains(status, "The changelog is locked by "+lockedBy()+" since ")
+}
+
+func TestReleaseLocks(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	status, err := Command{}.releaseLocks(ctx, conn, strings.NewReader(""), &bytes.Buffer{})
+	r.NoError(err)
+	r.Equal("The changelog is not locked.", status)
+
+	r.NoError(ensureLockRow(ctx, conn))
+	_, err = conn.Exec(ctx, lockStmt, time.Now(), "other-host (1)")
+	r.NoError(err)
+
+	for _, answer := range []string{"", "n\n", "nope\n"} {
+		var out bytes.Buffer
+		status, err = Command{}.releaseLocks(ctx, conn, strings.NewReader(answer), &out)
+		r.NoError(err)
+		r.Equal("The changelog lock was not released.", status)
+		r.Contains(out.String(), "The changelog is locked by other-host (1) since ")
+		r.Contains(out.String(), "release it? [y/N] ")
+
+		locked, _, _, err := currentLock(ctx, conn)
+		r.NoError(err)
+		r.True(locked)
+	}
+
+	status, err = Command{}.releaseLocks(ctx, conn, strings.NewReader("Yes\n"), &bytes.Buffer{})
+	r.NoError(err)
+	r.Equal("The changelog lock was released.", status)
+
+	locked, _, _, err := currentLock(ctx, conn)
+	r.NoError(err)
+	r.False(locked)
+
+	t.Run("force", func(t *testing.T) {
+		r := require.New(t)
+		_, err = conn.Exec(ctx, lockStmt, time.Now(), "other-host (1)")
+		r.NoError(err)
+
+		var out bytes.Buffer
+		status, err = Command{force: true}.releaseLocks(ctx, conn, strings.NewReader(""), &out)
+		r.NoError(err)
+		r.Equal("The changelog lock was released.", status)
+		r.Empty(out.String(), "--force doesn't ask for confirmation")
+
+		locked, _, _, err := currentLock(ctx, conn)
+		r.NoError(err)
+		r.False(locked)
+	})
+}
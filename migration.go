@@ -3,5 +3,41 @@ package liquo
 // Migration xml with liquibase format. A migration may be composed
 // of multiple changesets.
 type Migration struct {
-	ChangeSets []ChangeSet `xml:"changeSet"`
+	PreConditions *PreConditions `xml:"preConditions"`
+	ChangeSets    []ChangeSet    `xml:"changeSet"`
+
+	// LogicalFilePath is the filename of the changesets
+	// that don't specify their own logicalFilePath.
+	LogicalFilePath string `xml:"logicalFilePath,attr"`
+}
+
+// resolve lets the changes that read files know the path
+// of the migration they live in, including rollback changes.
+func (m *Migration) resolve(path string) {
+	for _, cs := range m.ChangeSets {
+		changes := cs.Changes
+		for _, rb := range cs.Rollbacks {
+			changes = append(changes[:len(changes):len(changes)], rb.Changes...)
+		}
+
+		for _, c := range changes {
+			if fc, ok := c.(fileChange); ok {
+				fc.resolve(path)
+			}
+		}
+	}
+}
+
+// filename returns the name the changeset is stored with in the
+// databasechangelog table, path is where the migration was read from.
+func (m Migration) filename(cs ChangeSet, path string) string {
+	if cs.LogicalFilePath != "" {
+		return cs.LogicalFilePath
+	}
+
+	if m.LogicalFilePath != "" {
+		return m.LogicalFilePath
+	}
+
+	return path
 }
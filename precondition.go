@@ -0,0 +1,389 @@
+package liquo
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// ErrPreconditionFailed is returned when preconditions fail or error
+// and their onFail or onError is HALT.
+var ErrPreconditionFailed = errors.New("preconditions failed")
+
+// Actions to take when preconditions fail or error.
+const (
+	onFailHalt     = "HALT"
+	onFailContinue = "CONTINUE"
+	onFailMarkRan  = "MARK_RAN"
+	onFailWarn     = "WARN"
+)
+
+// Precondition is one of the Liquibase preconditions, it checks
+// the state of the database before changes run.
+type Precondition interface {
+	Check(ctx context.Context, conn *pgx.Conn) (bool, error)
+}
+
+// preconditionTypes maps the Liquibase element names to the
+// Precondition each one unmarshals into.
+var preconditionTypes = map[string]func() Precondition{
+	"and": func() Precondition { return &And{} },
+	"or":  func() Precondition { return &Or{} },
+	"not": func() Precondition { return &Not{} },
+
+	"tableExists":                func() Precondition { return &TableExists{} },
+	"columnExists":               func() Precondition { return &ColumnExists{} },
+	"indexExists":                func() Precondition { return &IndexExists{} },
+	"foreignKeyConstraintExists": func() Precondition { return &ForeignKeyConstraintExists{} },
+	"sequenceExists":             func() Precondition { return &SequenceExists{} },
+	"viewExists":                 func() Precondition { return &ViewExists{} },
+	"sqlCheck":                   func() Precondition { return &SQLCheck{} },
+	"changeSetExecuted":          func() Precondition { return &ChangeSetExecuted{} },
+	"dbms":                       func() Precondition { return &DBMS{} },
+	"runningAs":                  func() Precondition { return &RunningAs{} },
+}
+
+// Conditions is a list of preconditions in the order they were written.
+type Conditions []Precondition
+
+// UnmarshalXML decodes the children of the element into
+// the preconditions they represent.
+func (c *Conditions) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			fn, ok := preconditionTypes[t.Name.Local]
+			if !ok {
+				return fmt.Errorf("unsupported precondition <%v>", t.Name.Local)
+			}
+
+			p := fn()
+			if err := d.DecodeElement(p, &t); err != nil {
+				return err
+			}
+
+			*c = append(*c, p)
+		}
+	}
+}
+
+// PreConditions is the Liquibase <preConditions> element, it can be in
+// changesets and changelogs. Its conditions must all pass for the changes
+// to run, onFail and onError say what to do otherwise.
+type PreConditions struct {
+	OnFail         string
+	OnError        string
+	OnFailMessage  string
+	OnErrorMessage string
+
+	Conditions
+}
+
+// UnmarshalXML decodes the attributes and then the
+// preconditions inside the element.
+func (p *PreConditions) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "onFail":
+			p.OnFail = strings.ToUpper(attr.Value)
+		case "onError":
+			p.OnError = strings.ToUpper(attr.Value)
+		case "onFailMessage":
+			p.OnFailMessage = attr.Value
+		case "onErrorMessage":
+			p.OnErrorMessage = attr.Value
+		}
+	}
+
+	return p.Conditions.UnmarshalXML(d, start)
+}
+
+// verify checks the preconditions for the named changeset or changelog and
+// returns what to do when they don't pass: CONTINUE or MARK_RAN. HALT is
+// returned as an error and WARN is logged, an empty action means go ahead.
+func (p *PreConditions) verify(ctx context.Context, conn *pgx.Conn, name string) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+
+	ok, err := And{p.Conditions}.Check(ctx, conn)
+	action, message := p.OnFail, p.OnFailMessage
+	if err != nil {
+		action, message = p.OnError, p.OnErrorMessage
+		if message == "" {
+			message = err.Error()
+		}
+	}
+
+	if ok && err == nil {
+		return "", nil
+	}
+
+	if message == "" {
+		message = "preconditions not met"
+	}
+
+	switch action {
+	case onFailContinue, onFailMarkRan:
+		log.Infof("Skipping %v: %v.", name, message)
+		return action, nil
+	case onFailWarn:
+		log.Warnf("%v: %v.\n", name, message)
+		return "", nil
+	}
+
+	return "", fmt.Errorf("%v: %w: %v", name, ErrPreconditionFailed, message)
+}
+
+// And passes when all its preconditions pass.
+type And struct {
+	Conditions
+}
+
+func (a And) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	for _, c := range a.Conditions {
+		ok, err := c.Check(ctx, conn)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Or passes when any of its preconditions passes.
+type Or struct {
+	Conditions
+}
+
+func (o Or) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	for _, c := range o.Conditions {
+		ok, err := c.Check(ctx, conn)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// Not passes when none of its preconditions pass.
+type Not struct {
+	Conditions
+}
+
+func (n Not) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	ok, err := Or(n).Check(ctx, conn)
+
+	return !ok, err
+}
+
+// TableExists is the Liquibase <tableExists> precondition.
+type TableExists struct {
+	SchemaName string `xml:"schemaName,attr"`
+	TableName  string `xml:"tableName,attr"`
+}
+
+func (te TableExists) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return exists(ctx, conn, `SELECT 1 FROM information_schema.tables WHERE table_schema = `+schema+` AND table_name = lower($2)`, te.SchemaName, te.TableName)
+}
+
+// ColumnExists is the Liquibase <columnExists> precondition.
+type ColumnExists struct {
+	SchemaName string `xml:"schemaName,attr"`
+	TableName  string `xml:"tableName,attr"`
+	ColumnName string `xml:"columnName,attr"`
+}
+
+func (ce ColumnExists) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return exists(ctx, conn, `SELECT 1 FROM information_schema.columns WHERE table_schema = `+schema+` AND table_name = lower($2) AND column_name = lower($3)`, ce.SchemaName, ce.TableName, ce.ColumnName)
+}
+
+// IndexExists is the Liquibase <indexExists> precondition, the
+// index is looked up by its name.
+type IndexExists struct {
+	SchemaName string `xml:"schemaName,attr"`
+	TableName  string `xml:"tableName,attr"`
+	IndexName  string `xml:"indexName,attr"`
+}
+
+func (ie IndexExists) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	if ie.IndexName == "" {
+		return false, errors.New("indexExists: indexName is required")
+	}
+
+	return exists(ctx, conn, `SELECT 1 FROM pg_indexes WHERE schemaname = `+schema+` AND indexname = lower($2) AND ($3 = '' OR tablename = lower($3))`, ie.SchemaName, ie.IndexName, ie.TableName)
+}
+
+// ForeignKeyConstraintExists is the Liquibase <foreignKeyConstraintExists> precondition.
+type ForeignKeyConstraintExists struct {
+	SchemaName          string `xml:"schemaName,attr"`
+	ForeignKeyTableName string `xml:"foreignKeyTableName,attr"`
+	ForeignKeyName      string `xml:"foreignKeyName,attr"`
+}
+
+func (fe ForeignKeyConstraintExists) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return exists(ctx, conn, `SELECT 1 FROM information_schema.table_constraints WHERE constraint_type = 'FOREIGN KEY' AND constraint_schema = `+schema+` AND constraint_name = lower($2) AND ($3 = '' OR table_name = lower($3))`, fe.SchemaName, fe.ForeignKeyName, fe.ForeignKeyTableName)
+}
+
+// SequenceExists is the Liquibase <sequenceExists> precondition.
+type SequenceExists struct {
+	SchemaName   string `xml:"schemaName,attr"`
+	SequenceName string `xml:"sequenceName,attr"`
+}
+
+func (se SequenceExists) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return exists(ctx, conn, `SELECT 1 FROM information_schema.sequences WHERE sequence_schema = `+schema+` AND sequence_name = lower($2)`, se.SchemaName, se.SequenceName)
+}
+
+// ViewExists is the Liquibase <viewExists> precondition.
+type ViewExists struct {
+	SchemaName string `xml:"schemaName,attr"`
+	ViewName   string `xml:"viewName,attr"`
+}
+
+func (ve ViewExists) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return exists(ctx, conn, `SELECT 1 FROM information_schema.views WHERE table_schema = `+schema+` AND table_name = lower($2)`, ve.SchemaName, ve.ViewName)
+}
+
+// SQLCheck is the Liquibase <sqlCheck> precondition, it passes when
+// the query returns a single value equal to expectedResult.
+type SQLCheck struct {
+	ExpectedResult string `xml:"expectedResult,attr"`
+	SQL            string `xml:",chardata"`
+}
+
+// Check runs the query with the simple protocol so the value comes as the
+// text PostgreSQL renders for it, the one compared with expectedResult.
+func (sc SQLCheck) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	rows, err := conn.Query(ctx, sc.SQL, pgx.QueryExecModeSimpleProtocol)
+	if err != nil {
+		return false, fmt.Errorf("sqlCheck: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err := rows.Err()
+		if err == nil {
+			err = pgx.ErrNoRows
+		}
+
+		return false, fmt.Errorf("sqlCheck: %w", err)
+	}
+
+	values := rows.RawValues()
+	if len(values) == 0 {
+		return false, errors.New("sqlCheck: the query returns no columns")
+	}
+
+	var result *string
+	if values[0] != nil {
+		text := string(values[0])
+		result = &text
+	}
+
+	passed := sc.matches(result, rows.FieldDescriptions()[0].DataTypeOID)
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("sqlCheck: %w", err)
+	}
+
+	return passed, nil
+}
+
+// matches returns whether the text of the result is the expected one, booleans
+// match true and false as well as the t and f PostgreSQL renders them as.
+func (sc SQLCheck) matches(result *string, oid uint32) bool {
+	expected := strings.TrimSpace(sc.ExpectedResult)
+	if result == nil {
+		return expected == "" || strings.EqualFold(expected, "NULL")
+	}
+
+	if oid == pgtype.BoolOID && (*result == "t" || *result == "f") {
+		return strings.EqualFold(expected, *result) || strings.EqualFold(expected, strconv.FormatBool(*result == "t"))
+	}
+
+	return *result == expected
+}
+
+// ChangeSetExecuted is the Liquibase <changeSetExecuted> precondition.
+type ChangeSetExecuted struct {
+	ID            string `xml:"id,attr"`
+	Author        string `xml:"author,attr"`
+	ChangeLogFile string `xml:"changeLogFile,attr"`
+}
+
+func (ce ChangeSetExecuted) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return exists(ctx, conn, `SELECT 1 FROM databasechangelog WHERE id = $1 AND author = $2 AND ($3 = '' OR filename = $3)`, ce.ID, ce.Author, ce.ChangeLogFile)
+}
+
+// DBMS is the Liquibase <dbms> precondition, the type is a comma separated
+// list of databases where ! excludes one. Liquo only runs on postgresql.
+type DBMS struct {
+	Type string `xml:"type,attr"`
+}
+
+func (db DBMS) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	return dbmsMatches(db.Type), nil
+}
+
+// RunningAs is the Liquibase <runningAs> precondition.
+type RunningAs struct {
+	Username string `xml:"username,attr"`
+}
+
+func (ra RunningAs) Check(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	var user string
+	err := conn.QueryRow(ctx, `SELECT current_user`).Scan(&user)
+
+	return strings.EqualFold(user, ra.Username), err
+}
+
+// schema is the SQL to compare with the schema passed as $1,
+// the current schema is used when it's empty.
+const schema = `COALESCE(NULLIF(lower($1), ''), current_schema())`
+
+// exists returns whether the query returns any row.
+func exists(ctx context.Context, conn *pgx.Conn, query string, args ...any) (bool, error) {
+	var ok bool
+	err := conn.QueryRow(ctx, `SELECT EXISTS (`+query+`)`, args...).Scan(&ok)
+
+	return ok, err
+}
+
+// dbmsMatches returns whether a Liquibase dbms list like
+// "postgresql, h2" or "!mysql" includes PostgreSQL.
+func dbmsMatches(list string) bool {
+	included, excluded := false, false
+	onlyExclusions := true
+	for _, t := range strings.Split(strings.ToLower(list), ",") {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "":
+		case t == "!postgresql":
+			excluded = true
+		case strings.HasPrefix(t, "!"):
+		case t == "postgresql" || t == "all":
+			included = true
+			onlyExclusions = false
+		default:
+			onlyExclusions = false
+		}
+	}
+
+	return !excluded && (included || onlyExclusions)
+}
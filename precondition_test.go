@@ -0,0 +1,136 @@
+package liquo
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreConditionsUnmarshal(t *testing.T) {
+	r := require.New(t)
+	data := `
+	<changeSet id="1" author="ox">
+		<preConditions onFail="mark_ran" onError="WARN" onFailMessage="already there">
+			<dbms type="postgresql"/>
+			<or>
+				<tableExists tableName="users" schemaName="app"/>
+				<not>
+					<columnExists tableName="users" columnName="email"/>
+				</not>
+			</or>
+			<sqlCheck expectedResult="0">SELECT count(*) FROM users</sqlCheck>
+		</preConditions>
+		<sql>SELECT 1;</sql>
+	</changeSet>`
+
+	cs := ChangeSet{}
+	r.NoError(xml.Unmarshal([]byte(data), &cs))
+	r.Len(cs.Changes, 1)
+
+	p := cs.PreConditions
+	r.NotNil(p)
+	r.Equal(onFailMarkRan, p.OnFail)
+	r.Equal(onFailWarn, p.OnError)
+	r.Equal("already there", p.OnFailMessage)
+	r.Len(p.Conditions, 3)
+
+	r.Equal(&DBMS{Type: "postgresql"}, p.Conditions[0])
+
+	or, ok := p.Conditions[1].(*Or)
+	r.True(ok)
+	r.Len(or.Conditions, 2)
+	r.Equal(&TableExists{SchemaName: "app", TableName: "users"}, or.Conditions[0])
+
+	not, ok := or.Conditions[1].(*Not)
+	r.True(ok)
+	r.Equal(&ColumnExists{TableName: "users", ColumnName: "email"}, not.Conditions[0])
+
+	r.Equal(&SQLCheck{ExpectedResult: "0", SQL: "SELECT count(*) FROM users"}, p.Conditions[2])
+}
+
+func TestPreConditionsVerify(t *testing.T) {
+	ctx := context.Background()
+	failing := Conditions{&DBMS{Type: "mysql"}}
+
+	tcases := []struct {
+		description string
+		conditions  *PreConditions
+		action      string
+		err         bool
+	}{
+		{"no preconditions", nil, "", false},
+		{"passing", &PreConditions{Conditions: Conditions{&DBMS{Type: "postgresql"}}}, "", false},
+		{"not passing", &PreConditions{Conditions: Conditions{&Not{Conditions{&DBMS{Type: "postgresql"}}}}}, "", true},
+		{"halt by default", &PreConditions{Conditions: failing}, "", true},
+		{"continue", &PreConditions{OnFail: onFailContinue, Conditions: failing}, onFailContinue, false},
+		{"mark ran", &PreConditions{OnFail: onFailMarkRan, Conditions: failing}, onFailMarkRan, false},
+		{"warn", &PreConditions{OnFail: onFailWarn, Conditions: failing}, "", false},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.description, func(t *testing.T) {
+			r := require.New(t)
+			action, err := tc.conditions.verify(ctx, nil, "changeset `1`")
+			r.Equal(tc.action, action)
+			if tc.err {
+				r.ErrorIs(err, ErrPreconditionFailed)
+				return
+			}
+
+			r.NoError(err)
+		})
+	}
+}
+
+func TestDBMSMatches(t *testing.T) {
+	r := require.New(t)
+	r.True(dbmsMatches("postgresql"))
+	r.True(dbmsMatches("h2, PostgreSQL"))
+	r.True(dbmsMatches("all"))
+	r.True(dbmsMatches("!mysql"))
+	r.False(dbmsMatches("mysql"))
+	r.False(dbmsMatches("!postgresql"))
+	r.False(dbmsMatches("all, !postgresql"))
+}
+
+func TestSQLCheck(t *testing.T) {
+	text := func(s string) *string { return &s }
+
+	t.Run("matches", func(t *testing.T) {
+		r := require.New(t)
+		r.True(SQLCheck{ExpectedResult: "0"}.matches(text("0"), pgtype.Int8OID))
+		r.True(SQLCheck{ExpectedResult: " 1.50 "}.matches(text("1.50"), pgtype.NumericOID))
+		r.False(SQLCheck{ExpectedResult: "1.5"}.matches(text("1.50"), pgtype.NumericOID))
+		r.True(SQLCheck{ExpectedResult: "true"}.matches(text("t"), pgtype.BoolOID))
+		r.True(SQLCheck{ExpectedResult: "f"}.matches(text("f"), pgtype.BoolOID))
+		r.False(SQLCheck{ExpectedResult: "true"}.matches(text("f"), pgtype.BoolOID))
+		r.False(SQLCheck{ExpectedResult: "true"}.matches(text("t"), pgtype.TextOID))
+		r.True(SQLCheck{ExpectedResult: "NULL"}.matches(nil, pgtype.TextOID))
+		r.True(SQLCheck{}.matches(nil, pgtype.TextOID))
+		r.False(SQLCheck{ExpectedResult: "0"}.matches(nil, pgtype.Int4OID))
+	})
+
+	t.Run("check", func(t *testing.T) {
+		r := require.New(t)
+		conn := testConn(t)
+		ctx := context.Background()
+
+		for sql, expected := range map[string]string{
+			"SELECT count(*) FROM databasechangelog": "0",
+			"SELECT 1.50::numeric":                   "1.50",
+			"SELECT 1 = 1":                           "true",
+			"SELECT DATE '2024-05-14'":               "2024-05-14",
+			"SELECT NULL":                            "NULL",
+		} {
+			passed, err := SQLCheck{SQL: sql, ExpectedResult: expected}.Check(ctx, conn)
+			r.NoError(err, sql)
+			r.True(passed, sql)
+		}
+
+		_, err := SQLCheck{SQL: "SELECT 1 WHERE FALSE", ExpectedResult: "1"}.Check(ctx, conn)
+		r.Error(err)
+	})
+}
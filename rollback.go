@@ -0,0 +1,582 @@
+package liquo
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// down rolls back changesets or writes the
+// SQL to do it when --dry-run is passed.
+func (lb *Command) down(ctx context.Context) error {
+	if lb.dryRun {
+		return lb.RollbackSQL(ctx)
+	}
+
+	return lb.RollbackContext(ctx)
+}
+
+// Rollback the changesets specified with the flags, see RollbackContext.
+func (lb *Command) Rollback() error {
+	return lb.RollbackContext(context.Background())
+}
+
+// RollbackContext rolls back the number of changesets specified with --steps,
+// the ones executed after --to-tag or --to-date, the ones of the last Up run
+// with --last-deployment or the one passed with --changeset. It holds the
+// changelog lock while running.
+func (lb *Command) RollbackContext(ctx context.Context) (err error) {
+	conn, err := lb.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	err = lb.acquireLock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer lb.deferReleaseLock(conn, &err)
+
+	plan, err := lb.rollbackPlan(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	if len(plan) == 0 {
+		log.Info("no migrations to run down.")
+
+		return nil
+	}
+
+	stmts, err := planStatements(plan)
+	if err != nil {
+		return err
+	}
+
+	for i, cs := range plan {
+		err = cs.rollback(ctx, conn, cs.file, stmts[i])
+		if err != nil {
+			log.Errorf("error rolling back `%v`.\n", cs.ID)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planStatements returns the rollback statements of each changeset of the
+// plan, a changeset that can't be rolled back fails before any of them runs.
+func planStatements(plan []fileChangeSet) ([][]Statement, error) {
+	stmts := make([][]Statement, 0, len(plan))
+	for _, cs := range plan {
+		s, err := cs.rollbackStatements()
+		if err != nil {
+			return nil, fmt.Errorf("can't roll back %v, nothing was rolled back: %w", cs.key(), err)
+		}
+
+		stmts = append(stmts, s)
+	}
+
+	return stmts, nil
+}
+
+// RollbackSQL writes the SQL script Rollback would run to stdout or the
+// --output file instead of running it. Changesets that can't be rolled
+// back are flagged in the script, Rollback stops at the first of them.
+func (lb *Command) RollbackSQL(ctx context.Context) error {
+	// Messages go to stderr so the script in stdout is valid SQL.
+	defer log.SetOutput(os.Stderr)()
+
+	conn, err := lb.connectReadOnly(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	plan, err := lb.rollbackPlan(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	w, err := lb.output()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	s := &sqlScript{w: w}
+	s.comment("Rollback SQL generated by liquo at %v", time.Now().Format(time.RFC3339))
+	s.comment("Lock the changelog")
+	s.write(Statement{SQL: lockRowStmt}, Statement{SQL: lockStmt, Args: []any{time.Now(), lockedBy()}})
+
+	missing, err := s.rollback(plan)
+	if err != nil {
+		return err
+	}
+
+	s.comment("Release the changelog lock")
+	s.write(Statement{SQL: unlockStmt, Args: []any{lockedBy()}})
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if missing > 0 {
+		log.Warnf("%d of the %d changesets can't be rolled back.\n", missing, len(plan))
+	}
+
+	if lb.outputFile != "" {
+		log.Infof("SQL written to %v.", lb.outputFile)
+	}
+
+	return nil
+}
+
+// rollback writes the statements that roll back the changesets of the plan
+// and returns how many of them were flagged because they have no rollback.
+func (s *sqlScript) rollback(plan []fileChangeSet) (int, error) {
+	missing := 0
+	for _, cs := range plan {
+		stmts, err := cs.rollbackStatements()
+		if errors.Is(err, ErrNoRollback) {
+			missing++
+			s.comment("WARNING: %v can't be rolled back: %v", cs.key(), err)
+
+			continue
+		}
+
+		if err != nil {
+			return missing, err
+		}
+
+		s.comment("Rollback %v", cs.key())
+		s.write(stmts...)
+		s.write(cs.unrecordStatement(cs.file))
+	}
+
+	return missing, nil
+}
+
+// rollbackPlan returns the changesets to roll back from the newest to the
+// oldest, these are resolved up front so rows that are not in the changelog
+// fail before anything is rolled back.
+func (lb Command) rollbackPlan(ctx context.Context, conn *pgx.Conn) ([]fileChangeSet, error) {
+	byKey, err := lb.changeSetsByKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := lb.rollbackKeys(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := resolvePlan(keys, byKey)
+	if err != nil || lb.changeSet == "" || len(plan) == 0 {
+		return plan, err
+	}
+
+	return plan, warnDependents(ctx, conn, plan[0], byKey)
+}
+
+// changeSetsByKey returns the changesets of the changelog by their key.
+func (lb Command) changeSetsByKey() (map[string]fileChangeSet, error) {
+	cl, err := lb.ReadChangelog()
+	if err != nil {
+		return nil, err
+	}
+
+	changeSets, err := lb.readChangeSets(cl)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]fileChangeSet{}
+	for _, cs := range changeSets {
+		byKey[cs.key()] = cs
+	}
+
+	return byKey, nil
+}
+
+// rollbackKeys returns the keys of the executed changesets to
+// roll back, from the newest to the oldest.
+func (lb Command) rollbackKeys(ctx context.Context, conn *pgx.Conn) ([]string, error) {
+	target, err := lb.rollbackTarget(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return target.keys(ctx, conn, target.limit)
+}
+
+// rollbackTarget is the executed changesets to roll back, the rows of the
+// databasechangelog table matching where, at most limit when it's not 0.
+// FAILED rows are never rolled back, their changes didn't happen.
+type rollbackTarget struct {
+	where string
+	args  []any
+	limit int
+}
+
+// keys returns the keys of the changesets of the target from the
+// newest to the oldest, at most limit of them when it's not 0.
+func (t rollbackTarget) keys(ctx context.Context, conn *pgx.Conn, limit int) ([]string, error) {
+	query := `SELECT filename, id, author FROM databasechangelog WHERE (` + t.where + `) AND exectype <> 'FAILED' ORDER BY orderexecuted DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	return queryKeys(ctx, conn, query, t.args...)
+}
+
+// rollbackTarget returns the changesets to roll back according to the
+// flags, only one of --steps, --to-tag, --to-date, --last-deployment
+// or --changeset can be passed.
+func (lb Command) rollbackTarget(ctx context.Context, conn *pgx.Conn) (rollbackTarget, error) {
+	targets := 0
+	for _, set := range []bool{lb.steps != 0, lb.toTag != "", lb.toDate != "", lb.changeSet != "", lb.lastDeployment} {
+		if set {
+			targets++
+		}
+	}
+
+	if targets > 1 {
+		return rollbackTarget{}, errors.New("use only one of --steps, --to-tag, --to-date, --last-deployment or --changeset")
+	}
+
+	if lb.steps < 0 {
+		return rollbackTarget{}, fmt.Errorf("invalid --steps %d, it must be positive", lb.steps)
+	}
+
+	if lb.changeSet != "" {
+		file, id, author, err := splitChangeSetKey(lb.changeSet)
+		if err != nil {
+			return rollbackTarget{}, err
+		}
+
+		t := rollbackTarget{where: `filename = $1 AND id = $2 AND author = $3`, args: []any{file, id, author}, limit: 1}
+		keys, err := t.keys(ctx, conn, 1)
+		if err == nil && len(keys) == 0 {
+			err = fmt.Errorf("changeset %v has not been executed", lb.changeSet)
+		}
+
+		return t, err
+	}
+
+	if lb.toDate != "" {
+		date, err := parseTime(lb.toDate)
+		if err != nil {
+			return rollbackTarget{}, fmt.Errorf("invalid --to-date: %w", err)
+		}
+
+		return rollbackTarget{where: `dateexecuted > $1`, args: []any{date}}, nil
+	}
+
+	if lb.lastDeployment {
+		var deployment *string
+		err := conn.QueryRow(ctx, `SELECT deployment_id FROM databasechangelog ORDER BY orderexecuted DESC LIMIT 1`).Scan(&deployment)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return rollbackTarget{}, errors.New("there is no last deployment, no changesets have been executed")
+		}
+
+		if err != nil {
+			return rollbackTarget{}, err
+		}
+
+		if deployment == nil {
+			return rollbackTarget{}, errors.New("the last changeset has no deployment id, it was executed before deployment ids were recorded")
+		}
+
+		return rollbackTarget{where: `deployment_id = $1`, args: []any{*deployment}}, nil
+	}
+
+	if lb.toTag != "" {
+		var order *int
+		err := conn.QueryRow(ctx, `SELECT max(orderexecuted) FROM databasechangelog WHERE tag = $1`, lb.toTag).Scan(&order)
+		if err != nil {
+			return rollbackTarget{}, err
+		}
+
+		if order == nil {
+			return rollbackTarget{}, fmt.Errorf("tag %q not found", lb.toTag)
+		}
+
+		return rollbackTarget{where: `orderexecuted > $1`, args: []any{*order}}, nil
+	}
+
+	// Default to 1 on down.
+	steps := lb.steps
+	if steps == 0 {
+		steps = 1
+	}
+
+	return rollbackTarget{where: `TRUE`, limit: steps}, nil
+}
+
+// queryKeys returns the keys of the changesets the query returns, it
+// must select their filename, id and author.
+func queryKeys(ctx context.Context, conn *pgx.Conn, query string, args ...any) ([]string, error) {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var file, id, author string
+		if err := rows.Scan(&file, &id, &author); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, changeSetKey(file, id, author))
+	}
+
+	return keys, rows.Err()
+}
+
+// resolvePlan finds the changesets of the keys in the
+// changelog, failing when any of them is not there.
+func resolvePlan(keys []string, byKey map[string]fileChangeSet) ([]fileChangeSet, error) {
+	plan := make([]fileChangeSet, 0, len(keys))
+	for _, key := range keys {
+		cs, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("changeset %v is not in the changelog, it can't be rolled back", key)
+		}
+
+		plan = append(plan, cs)
+	}
+
+	return plan, nil
+}
+
+// warnDependents warns about the changesets executed after the one being
+// rolled back that change the same tables, these may depend on it.
+func warnDependents(ctx context.Context, conn *pgx.Conn, cs fileChangeSet, byKey map[string]fileChangeSet) error {
+	keys, err := queryKeys(ctx, conn, `
+		SELECT filename, id, author FROM databasechangelog
+		WHERE orderexecuted > (SELECT orderexecuted FROM databasechangelog WHERE filename = $1 AND id = $2 AND author = $3)
+			AND exectype <> 'FAILED'
+		ORDER BY orderexecuted`,
+		cs.file, cs.ID, cs.Author,
+	)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	var later []fileChangeSet
+	for _, key := range keys {
+		if l, ok := byKey[key]; ok {
+			later = append(later, l)
+		}
+	}
+
+	dependents := dependentsOf(cs, later)
+	if len(dependents) == 0 && len(cs.tables()) > 0 {
+		return nil
+	}
+
+	if len(dependents) == 0 {
+		log.Warnf("%d changesets were executed after %v, make sure none of them depends on it.\n", len(keys), cs.key())
+		return nil
+	}
+
+	var list strings.Builder
+	for _, d := range dependents {
+		list.WriteString("  - " + d.key() + "\n")
+	}
+
+	log.Warnf("These changesets were executed after %v and change the same tables, they may depend on it:\n%v", cs.key(), list.String())
+
+	return nil
+}
+
+// dependentsOf returns the changesets that change any of the tables of cs.
+func dependentsOf(cs fileChangeSet, later []fileChangeSet) []fileChangeSet {
+	tables := map[string]bool{}
+	for _, t := range cs.tables() {
+		tables[t] = true
+	}
+
+	var dependents []fileChangeSet
+	for _, l := range later {
+		for _, t := range l.tables() {
+			if tables[t] {
+				dependents = append(dependents, l)
+				break
+			}
+		}
+	}
+
+	return dependents
+}
+
+// tables returns the tables the changes of the changeset refer to, taken
+// from their attributes ending in TableName. Tables in sql are not known.
+func (cs ChangeSet) tables() []string {
+	seen := map[string]bool{}
+	var tables []string
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				f := v.Type().Field(i)
+				if !f.IsExported() && !f.Anonymous {
+					continue
+				}
+
+				if f.Type.Kind() == reflect.String && strings.HasSuffix(f.Name, "TableName") {
+					if name := strings.ToLower(v.Field(i).String()); name != "" && !seen[name] {
+						seen[name] = true
+						tables = append(tables, name)
+					}
+				}
+
+				walk(v.Field(i))
+			}
+		}
+	}
+
+	for _, c := range cs.Changes {
+		walk(reflect.ValueOf(c))
+	}
+
+	return tables
+}
+
+// splitChangeSetKey splits a file::id::author changeset key.
+func splitChangeSetKey(key string) (string, string, string, error) {
+	parts := strings.Split(key, "::")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid changeset %q, use file::id::author", key)
+	}
+
+	return parts[0], parts[1], parts[2], nil
+}
+
+// Rollback is a <rollback> element of a changeset. It has the SQL or the
+// changes that undo the changeset, or references another changeset whose
+// changes undo it with changeSetId, changeSetAuthor and changeSetPath.
+type Rollback struct {
+	SQL             string `xml:",chardata"`
+	ChangeSetID     string `xml:"changeSetId,attr"`
+	ChangeSetAuthor string `xml:"changeSetAuthor,attr"`
+	ChangeSetPath   string `xml:"changeSetPath,attr"`
+
+	Changes []Change `xml:"-"`
+
+	// resolved is set once the changes of the
+	// referenced changeset are in Changes.
+	resolved bool
+}
+
+// UnmarshalXML decodes the attributes and the SQL of the
+// rollback and then the changes in it.
+func (rb *Rollback) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type rollback Rollback
+	var raw struct {
+		rollback
+		Inner []byte `xml:",innerxml"`
+	}
+
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*rb = Rollback(raw.rollback)
+
+	changes, err := decodeChanges(raw.Inner)
+	if err != nil {
+		return fmt.Errorf("rollback: %w", err)
+	}
+
+	rb.Changes = changes
+
+	return nil
+}
+
+// statements returns the SQL of the rollback followed by the
+// statements of its changes or the ones of the changeset it references.
+func (rb Rollback) statements() ([]Statement, error) {
+	if rb.ChangeSetID != "" && !rb.resolved {
+		return nil, fmt.Errorf("rollback references changeset `%v` which was not found", rb.ChangeSetID)
+	}
+
+	var stmts []Statement
+	if strings.TrimSpace(rb.SQL) != "" {
+		stmts = append(stmts, Statement{SQL: rb.SQL})
+	}
+
+	for _, c := range rb.Changes {
+		s, err := c.Statements()
+		if err != nil {
+			return nil, err
+		}
+
+		stmts = append(stmts, s...)
+	}
+
+	return stmts, nil
+}
+
+// resolveRollbacks puts the changes of the changesets referenced by
+// rollbacks in them. References without changeSetPath are to changesets
+// in the same file, the path can be the file of the include or the
+// logicalFilePath of the changeset.
+func resolveRollbacks(changeSets []fileChangeSet) error {
+	for i, cs := range changeSets {
+		for j, rb := range cs.Rollbacks {
+			if rb.ChangeSetID == "" {
+				continue
+			}
+
+			path := rb.ChangeSetPath
+			if path == "" {
+				path = cs.path
+			}
+
+			ref, ok := findChangeSet(changeSets, path, rb.ChangeSetID, rb.ChangeSetAuthor)
+			if !ok {
+				return fmt.Errorf("changeset %v: rollback references changeset %v which is not in the changelog", cs.key(), changeSetKey(path, rb.ChangeSetID, rb.ChangeSetAuthor))
+			}
+
+			changeSets[i].Rollbacks[j].Changes = append(rb.Changes, ref.Changes...)
+			changeSets[i].Rollbacks[j].resolved = true
+		}
+	}
+
+	return nil
+}
+
+// findChangeSet finds the changeset by its path, id and author,
+// any author matches when it's empty.
+func findChangeSet(changeSets []fileChangeSet, path, id, author string) (fileChangeSet, bool) {
+	for _, cs := range changeSets {
+		if (cs.path == path || cs.file == path) && cs.ID == id && (author == "" || cs.Author == author) {
+			return cs, true
+		}
+	}
+
+	return fileChangeSet{}, false
+}
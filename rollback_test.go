@@ -0,0 +1,265 @@
+package liquo
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackScript(t *testing.T) {
+	r := require.New(t)
+	parse := func(data string) fileChangeSet {
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		return fileChangeSet{ChangeSet: cs, file: "a.xml"}
+	}
+
+	plan := []fileChangeSet{
+		parse(`<changeSet id="2" author="ox"><sql>UPDATE users SET name = 'a';</sql></changeSet>`),
+		parse(`<changeSet id="1" author="ox"><createTable tableName="users"><column name="id" type="int"/></createTable></changeSet>`),
+	}
+
+	var out bytes.Buffer
+	s := &sqlScript{w: &out}
+	missing, err := s.rollback(plan)
+	r.NoError(err)
+	r.NoError(s.err)
+	r.Equal(1, missing)
+
+	script := out.String()
+	r.Contains(script, "-- WARNING: a.xml::2::ox can't be rolled back")
+	r.Contains(script, "-- Rollback a.xml::1::ox\nDROP TABLE users;\nDELETE FROM databasechangelog WHERE id = '1' AND author = 'ox' AND filename = 'a.xml';\n")
+}
+
+func TestResolvePlan(t *testing.T) {
+	r := require.New(t)
+	byKey := map[string]fileChangeSet{
+		"a.xml::1::ox": {ChangeSet: ChangeSet{ID: "1", Author: "ox"}, file: "a.xml"},
+		"a.xml::2::ox": {ChangeSet: ChangeSet{ID: "2", Author: "ox"}, file: "a.xml"},
+	}
+
+	plan, err := resolvePlan([]string{"a.xml::2::ox", "a.xml::1::ox"}, byKey)
+	r.NoError(err)
+	r.Len(plan, 2)
+	r.Equal("2", plan[0].ID)
+
+	_, err = resolvePlan([]string{"a.xml::2::ox", "b.xml::1::ox"}, byKey)
+	r.ErrorContains(err, "changeset b.xml::1::ox is not in the changelog")
+}
+
+func TestPlanStatements(t *testing.T) {
+	r := require.New(t)
+	parse := func(data string) fileChangeSet {
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		return fileChangeSet{ChangeSet: cs, file: "a.xml"}
+	}
+
+	users := parse(`<changeSet id="1" author="ox"><createTable tableName="users"><column name="id" type="int"/></createTable></changeSet>`)
+	stmts, err := planStatements([]fileChangeSet{users})
+	r.NoError(err)
+	r.Len(stmts, 1)
+	r.Equal("DROP TABLE users", stmts[0][0].SQL)
+
+	// The changeset that can't be rolled back is the last one of the plan.
+	sql := parse(`<changeSet id="2" author="ox"><sql>UPDATE users SET name = 'a';</sql></changeSet>`)
+	_, err = planStatements([]fileChangeSet{users, sql})
+	r.ErrorIs(err, ErrNoRollback)
+	r.ErrorContains(err, "can't roll back a.xml::2::ox, nothing was rolled back")
+}
+
+func TestDependentsOf(t *testing.T) {
+	r := require.New(t)
+	parse := func(id, changes string) fileChangeSet {
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(`<changeSet id="`+id+`" author="ox">`+changes+`</changeSet>`), &cs))
+
+		return fileChangeSet{ChangeSet: cs, file: "a.xml"}
+	}
+
+	users := parse("1", `<createTable tableName="Users"><column name="id" type="int"/></createTable>`)
+	r.Equal([]string{"users"}, users.tables())
+
+	later := []fileChangeSet{
+		parse("2", `<createTable tableName="posts"><column name="user_id" type="int"><constraints references="users(id)" referencedTableName="users" foreignKeyName="fk_posts_users"/></column></createTable>`),
+		parse("3", `<addColumn tableName="tags"><column name="name" type="text"/></addColumn>`),
+		parse("4", `<loadData tableName="users" file="users.csv"/>`),
+		parse("5", `<sql>ALTER TABLE users ADD COLUMN age int;</sql>`),
+	}
+
+	r.Equal([]string{"posts", "users"}, later[0].tables())
+	r.Empty(later[3].tables())
+
+	dependents := dependentsOf(users, later)
+	r.Len(dependents, 2)
+	r.Equal("2", dependents[0].ID)
+	r.Equal("4", dependents[1].ID)
+}
+
+func TestRollbackTarget(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	target, err := Command{}.rollbackTarget(ctx, nil)
+	r.NoError(err)
+	r.Equal(1, target.limit, "one changeset is rolled back by default")
+
+	target, err = Command{steps: 3}.rollbackTarget(ctx, nil)
+	r.NoError(err)
+	r.Equal(3, target.limit)
+
+	_, err = Command{steps: -1}.rollbackTarget(ctx, nil)
+	r.ErrorContains(err, "invalid --steps -1")
+
+	_, err = Command{steps: 2, toTag: "v1"}.rollbackTarget(ctx, nil)
+	r.ErrorContains(err, "use only one of")
+}
+
+func TestSplitChangeSetKey(t *testing.T) {
+	r := require.New(t)
+
+	file, id, author, err := splitChangeSetKey("migrations/a.xml::1::ox")
+	r.NoError(err)
+	r.Equal([]string{"migrations/a.xml", "1", "ox"}, []string{file, id, author})
+
+	_, _, _, err = splitChangeSetKey("migrations/a.xml::1")
+	r.Error(err)
+}
+
+func TestRollbackBlocks(t *testing.T) {
+	r := require.New(t)
+	parse := func(data string) fileChangeSet {
+		cs := ChangeSet{}
+		r.NoError(xml.Unmarshal([]byte(data), &cs))
+
+		return fileChangeSet{ChangeSet: cs, file: "db/a.xml", path: "migrations/a.xml"}
+	}
+
+	t.Run("multiple blocks with changes", func(t *testing.T) {
+		cs := parse(`<changeSet id="1" author="ox">
+			<sql>CREATE TABLE a (id int); CREATE TABLE b (id int);</sql>
+			<rollback>DROP TABLE b;</rollback>
+			<rollback><dropTable tableName="a"/></rollback>
+		</changeSet>`)
+
+		stmts, err := cs.rollbackStatements()
+		r.NoError(err)
+		r.Equal([]Statement{{SQL: "DROP TABLE b;"}, {SQL: "DROP TABLE a"}}, stmts)
+	})
+
+	t.Run("references", func(t *testing.T) {
+		changeSets := []fileChangeSet{
+			parse(`<changeSet id="create" author="ox"><createTable tableName="a"><column name="id" type="int"/></createTable></changeSet>`),
+			parse(`<changeSet id="drop" author="ox"><dropTable tableName="a"/><rollback changeSetId="create" changeSetAuthor="ox"/></changeSet>`),
+			parse(`<changeSet id="drop-again" author="ox"><dropTable tableName="a"/><rollback changeSetId="create" changeSetPath="db/a.xml"/></changeSet>`),
+		}
+
+		_, err := changeSets[1].rollbackStatements()
+		r.ErrorContains(err, "rollback references changeset `create` which was not found")
+
+		r.NoError(resolveRollbacks(changeSets))
+		for _, cs := range changeSets[1:] {
+			stmts, err := cs.rollbackStatements()
+			r.NoError(err)
+			r.Len(stmts, 1)
+			r.Contains(stmts[0].SQL, "CREATE TABLE a")
+		}
+
+		missing := []fileChangeSet{parse(`<changeSet id="drop" author="ox"><dropTable tableName="a"/><rollback changeSetId="other" changeSetAuthor="ox"/></changeSet>`)}
+		r.ErrorContains(resolveRollbacks(missing), "rollback references changeset migrations/a.xml::other::ox which is not in the changelog")
+	})
+}
+
+func TestRollbackKeysLastDeployment(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+	lb := Command{lastDeployment: true}
+
+	_, err := lb.rollbackKeys(ctx, conn)
+	r.ErrorContains(err, "there is no last deployment")
+
+	record := func(id string, order int, deployment string) {
+		h := &changeLogHistory{ran: map[string]string{}, order: order - 1, deploymentID: deployment}
+		stmt := ChangeSet{ID: id, Author: "ox"}.recordStatement("a.xml", "EXECUTED", h)
+		_, err := conn.Exec(ctx, stmt.SQL, stmt.Args...)
+		r.NoError(err)
+	}
+
+	record("1", 1, "1111111111")
+	record("2", 2, "2222222222")
+	record("3", 3, "2222222222")
+	record("4", 4, "3333333333")
+	record("5", 5, "3333333333")
+	record("6", 6, "3333333333")
+
+	keys, err := lb.rollbackKeys(ctx, conn)
+	r.NoError(err)
+	r.Equal([]string{"a.xml::6::ox", "a.xml::5::ox", "a.xml::4::ox"}, keys)
+
+	_, err = conn.Exec(ctx, `UPDATE databasechangelog SET deployment_id = NULL WHERE id = '6'`)
+	r.NoError(err)
+
+	_, err = lb.rollbackKeys(ctx, conn)
+	r.ErrorContains(err, "the last changeset has no deployment id")
+}
+
+func TestRollbackSQLStdout(t *testing.T) {
+	r := require.New(t)
+	conn := testConn(t)
+	ctx := context.Background()
+
+	drop := func() {
+		_, err := conn.Exec(ctx, `DROP TABLE IF EXISTS rollback_sql_users`)
+		r.NoError(err)
+	}
+
+	drop()
+	t.Cleanup(drop)
+
+	lb := testCommand(t, map[string]string{
+		"migrations/changelog.xml": `<databaseChangeLog><include file="migrations/users.xml"/></databaseChangeLog>`,
+		"migrations/users.xml": `<databaseChangeLog>
+			<changeSet id="1" author="ox">
+				<createTable tableName="rollback_sql_users"><column name="name" type="text"/></createTable>
+			</changeSet>
+			<changeSet id="2" author="ox">
+				<addColumn tableName="rollback_sql_users"><column name="email" type="text"/></addColumn>
+			</changeSet>
+			<changeSet id="3" author="ox">
+				<sql>UPDATE rollback_sql_users SET email = name;</sql>
+			</changeSet>
+		</databaseChangeLog>`,
+	})
+	r.NoError(lb.UpContext(ctx))
+
+	// The last changeset can't be rolled back and the first one has
+	// dependents, both are warned about.
+	lb.steps = 3
+	steps := captureStdout(t, func() {
+		r.NoError(lb.RollbackSQL(ctx))
+	})
+
+	lb.steps, lb.changeSet = 0, "migrations/users.xml::1::ox"
+	changeSet := captureStdout(t, func() {
+		r.NoError(lb.RollbackSQL(ctx))
+	})
+
+	for _, script := range []string{steps, changeSet} {
+		r.NotContains(script, "[warning]")
+		r.NotContains(script, "  - migrations/users.xml")
+		r.Contains(script, "DROP TABLE rollback_sql_users;")
+
+		tx, err := conn.Begin(ctx)
+		r.NoError(err)
+
+		_, err = tx.Exec(ctx, script)
+		r.NoError(err, "the script in stdout is valid SQL")
+		r.NoError(tx.Rollback(ctx))
+	}
+}
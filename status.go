@@ -0,0 +1,69 @@
+package liquo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// ErrPendingChangeSets is returned by status with --exit-code
+// when there are changesets to run.
+var ErrPendingChangeSets = errors.New("there are pending changesets")
+
+// Status prints the changesets that would run with the contexts and labels
+// passed, with --exit-code it fails when there are any.
+func (lb Command) Status(ctx context.Context) error {
+	conn, err := lb.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	cl, err := lb.ReadChangelog()
+	if err != nil {
+		return err
+	}
+
+	changeSets, err := lb.readChangeSets(cl)
+	if err != nil {
+		return err
+	}
+
+	h, err := loadHistory(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	pending, err := lb.pending(h, changeSets)
+	if err != nil {
+		return err
+	}
+
+	return lb.writeStatus(os.Stdout, pending)
+}
+
+// writeStatus lists the pending changesets in w, with --exit-code
+// it fails when there are any.
+func (lb Command) writeStatus(w io.Writer, pending []fileChangeSet) error {
+	if len(pending) == 0 {
+		log.Info("Database up to date.")
+		return nil
+	}
+
+	log.Infof("%d changesets pending:", len(pending))
+	for _, cs := range pending {
+		if _, err := fmt.Fprintf(w, "  - %v\n", cs.key()); err != nil {
+			return err
+		}
+	}
+
+	if lb.exitCode {
+		return fmt.Errorf("%w: %d", ErrPendingChangeSets, len(pending))
+	}
+
+	return nil
+}
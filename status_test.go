@@ -0,0 +1,66 @@
+package liquo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	r := require.New(t)
+	changeSet := func(id string, attrs ChangeSet) fileChangeSet {
+		attrs.ID, attrs.Author = id, "ox"
+		attrs.Changes = []Change{&RawSQL{SQL: "SELECT " + id + ";"}}
+
+		return fileChangeSet{ChangeSet: attrs, file: "a.xml"}
+	}
+
+	changeSets := []fileChangeSet{
+		changeSet("1", ChangeSet{}),
+		changeSet("2", ChangeSet{}),
+		changeSet("3", ChangeSet{Context: "test"}),
+		changeSet("4", ChangeSet{Context: "dev", Labels: "billing"}),
+		changeSet("5", ChangeSet{RunAlways: true}),
+		changeSet("6", ChangeSet{Labels: "reports"}),
+	}
+
+	h := &changeLogHistory{ran: map[string]string{}}
+	h.add(changeSets[0].ChangeSet, "a.xml", 1)
+	h.add(changeSets[4].ChangeSet, "a.xml", 2)
+
+	lb := Command{contexts: "dev", labels: "billing"}
+	pending, err := lb.pending(h, changeSets)
+	r.NoError(err)
+
+	var out bytes.Buffer
+	r.NoError(lb.writeStatus(&out, pending))
+	r.Equal("  - a.xml::2::ox\n  - a.xml::4::ox\n  - a.xml::5::ox\n", out.String(), "executed changesets and the ones filtered out are not pending")
+
+	lb.exitCode = true
+	out.Reset()
+	err = lb.writeStatus(&out, pending)
+	r.ErrorIs(err, ErrPendingChangeSets)
+	r.ErrorContains(err, ": 3")
+
+	for _, cs := range pending {
+		h.add(cs.ChangeSet, cs.file, h.order+1)
+	}
+
+	pending, err = lb.pending(h, changeSets)
+	r.NoError(err)
+	r.Equal([]string{"a.xml::5::ox"}, keys(pending), "runAlways changesets are always pending")
+
+	out.Reset()
+	r.NoError(lb.writeStatus(&out, nil), "--exit-code doesn't fail when nothing is pending")
+	r.Empty(out.String())
+}
+
+func keys(changeSets []fileChangeSet) []string {
+	var keys []string
+	for _, cs := range changeSets {
+		keys = append(keys, cs.key())
+	}
+
+	return keys
+}
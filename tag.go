@@ -0,0 +1,57 @@
+package liquo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// ErrNoTagName is returned when the tag direction has no name.
+var ErrNoTagName = errors.New("specify the tag name: ox db migrate tag <name>")
+
+// Tag stores the tag in the most recent row of the databasechangelog
+// table so changesets executed after it can be rolled back with --to-tag.
+func (lb Command) Tag(ctx context.Context, name string) (err error) {
+	conn, err := lb.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	err = lb.acquireLock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer lb.deferReleaseLock(conn, &err)
+
+	tag, err := conn.Exec(ctx, `
+		UPDATE databasechangelog SET tag = $1
+		WHERE (id, author, filename) = (SELECT id, author, filename FROM databasechangelog ORDER BY orderexecuted DESC LIMIT 1)`,
+		name,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("could not tag %q, no changesets have been executed", name)
+	}
+
+	log.Infof("Tagged the database with %q.", name)
+
+	return nil
+}
+
+// tag returns the tag of the <tagDatabase> changes of the changeset.
+func (cs ChangeSet) tag() string {
+	var tag string
+	for _, c := range cs.Changes {
+		if td, ok := c.(*TagDatabase); ok {
+			tag = td.Tag
+		}
+	}
+
+	return tag
+}
@@ -0,0 +1,108 @@
+package liquo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/wawandco/liquo/internal/log"
+)
+
+// ErrChecksumMismatch is returned when changesets were modified
+// after being executed.
+var ErrChecksumMismatch = errors.New("changesets were modified after being executed")
+
+// Validate compares the checksum of the changesets already executed with
+// the one stored in the databasechangelog table. Rows without a checksum
+// get the current one stored, no other checksum is ever overwritten.
+func (lb Command) Validate(conn *pgx.Conn, changeSets []fileChangeSet) error {
+	ctx := context.Background()
+
+	h, err := loadHistory(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return lb.validate(ctx, conn, h, changeSets)
+}
+
+// validate compares the checksums with the ones in the history
+// and stores the checksum of the rows that have none.
+func (lb Command) validate(ctx context.Context, conn *pgx.Conn, h *changeLogHistory, changeSets []fileChangeSet) error {
+	missing, err := checkChecksums(h, changeSets)
+	if err != nil {
+		return err
+	}
+
+	for _, cs := range missing {
+		stmt := cs.checksumStatement()
+		_, err := conn.Exec(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return err
+		}
+
+		h.ran[cs.key()] = cs.Checksum()
+	}
+
+	return nil
+}
+
+// checksumStatement returns the statement that stores the checksum
+// of the changeset when it was executed without one.
+func (cs fileChangeSet) checksumStatement() Statement {
+	return Statement{
+		SQL:  `UPDATE databasechangelog SET md5sum = $1 WHERE id = $2 AND author = $3 AND filename = $4 AND md5sum IS NULL`,
+		Args: []any{cs.Checksum(), cs.ID, cs.Author, cs.file},
+	}
+}
+
+// checkChecksums returns the executed changesets that have no checksum
+// stored and fails listing the ones whose checksum doesn't match. Checksums
+// of other Liquibase versions can't be compared, these are not validated.
+func checkChecksums(h *changeLogHistory, changeSets []fileChangeSet) ([]fileChangeSet, error) {
+	var missing []fileChangeSet
+	var modified, unverified []string
+	for _, cs := range changeSets {
+		executed, md5sum := h.executed(cs.ChangeSet, cs.file)
+		if !executed {
+			continue
+		}
+
+		checksum := cs.Checksum()
+		switch {
+		case md5sum == "":
+			missing = append(missing, cs)
+		case md5sum == checksum || cs.RunOnChange || cs.validChecksum(md5sum):
+			continue
+		case !strings.HasPrefix(md5sum, checksumVersion+":"):
+			unverified = append(unverified, cs.key())
+		default:
+			modified = append(modified, fmt.Sprintf("  - %v was %v but is now %v", cs.key(), md5sum, checksum))
+		}
+	}
+
+	if len(unverified) > 0 {
+		log.Warnf("%d executed changesets have checksums of another Liquibase version, these are not validated.\n", len(unverified))
+	}
+
+	if len(modified) == 0 {
+		return missing, nil
+	}
+
+	return nil, fmt.Errorf("%w:\n%v", ErrChecksumMismatch, strings.Join(modified, "\n"))
+}
+
+// validChecksum returns whether the checksum was listed
+// as valid for the changeset with <validCheckSum>.
+func (cs ChangeSet) validChecksum(checksum string) bool {
+	for _, v := range cs.ValidCheckSums {
+		v = strings.TrimSpace(v)
+		if v == checksum || strings.EqualFold(v, "ANY") || strings.EqualFold(v, "1:any") {
+			return true
+		}
+	}
+
+	return false
+}